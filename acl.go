@@ -0,0 +1,99 @@
+package email
+
+import "github.com/emersion/go-imap/v2"
+
+// MyRights 获取当前用户对邮箱拥有的权限(MYRIGHTS，RFC 4314)
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//
+// 返回:
+//   - imap.RightSet: 权限集合，如"lrswipkxtea"，可用strings.ContainsRune判断单项权限
+//   - error: 服务器不支持ACL扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) MyRights(mailbox string) (imap.RightSet, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	var rights imap.RightSet
+	err := c.withConn(func() error {
+		if err := c.requireCap(imap.CapACL); err != nil {
+			return err
+		}
+		data, err := c.client.MyRights(mailbox).Wait()
+		if err != nil {
+			return err
+		}
+		rights = data.Rights
+		return nil
+	})
+	return rights, err
+}
+
+// GetACL 获取邮箱的访问控制列表(GETACL)，需要对邮箱有管理权限(a)
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//
+// 返回:
+//   - map[imap.RightsIdentifier]imap.RightSet: 每个用户（或"anyone"）拥有的权限
+//   - error: 服务器不支持ACL扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetACL(mailbox string) (map[imap.RightsIdentifier]imap.RightSet, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	var acl map[imap.RightsIdentifier]imap.RightSet
+	err := c.withConn(func() error {
+		if err := c.requireCap(imap.CapACL); err != nil {
+			return err
+		}
+		data, err := c.client.GetACL(mailbox).Wait()
+		if err != nil {
+			return err
+		}
+		acl = data.Rights
+		return nil
+	})
+	return acl, err
+}
+
+// SetACL 修改用户对邮箱的权限(SETACL)，需要对邮箱有管理权限(a)
+// 参数:
+//   - mailbox: 邮箱名称
+//   - identifier: 用户名，或imap.RightsIdentifierAnyone表示所有人
+//   - rights: 权限集合，以"+"开头表示添加，以"-"开头表示移除，否则替换原有权限；
+//     例如"+lrs"授予只读访问，"-w"收回写权限，"lrswipkxtea"授予全部权限
+//
+// 返回:
+//   - error: 服务器不支持ACL扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) SetACL(mailbox string, identifier imap.RightsIdentifier, rights string) error {
+	modification := imap.RightModificationReplace
+	if len(rights) > 0 && (rights[0] == '+' || rights[0] == '-') {
+		modification = imap.RightModification(rights[0])
+		rights = rights[1:]
+	}
+
+	return c.withConn(func() error {
+		if err := c.requireCap(imap.CapACL); err != nil {
+			return err
+		}
+		return c.client.SetACL(mailbox, identifier, modification, imap.RightSet(rights)).Wait()
+	})
+}
+
+// Namespace 获取服务器的命名空间(NAMESPACE，RFC 2342)
+// Personal为当前用户自己的邮箱，Other为其他用户的邮箱（如"Other Users/"），
+// Shared为共享邮箱（如"Shared Folders/"）；邮箱名称以对应的Prefix开头
+// 返回:
+//   - *imap.NamespaceData: 三类命名空间的前缀和层级分隔符
+//   - error: 服务器不支持NAMESPACE扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) Namespace() (*imap.NamespaceData, error) {
+	var data *imap.NamespaceData
+	err := c.withConn(func() (err error) {
+		if err := c.requireCap(imap.CapNamespace); err != nil {
+			return err
+		}
+		data, err = c.client.Namespace().Wait()
+		return err
+	})
+	return data, err
+}
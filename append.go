@@ -0,0 +1,205 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// Append 将原始邮件（RFC 5322格式）上传到指定邮箱
+// 服务器支持LITERAL-时，小于4KB的邮件不会等待服务器的继续响应
+// 参数:
+//   - mailbox: 目标邮箱名称，默认为"INBOX"
+//   - r: 邮件原始内容
+//   - flags: 邮件标志，如imap.FlagSeen，可为nil
+//   - date: 邮件的内部日期(INTERNALDATE)，零值表示由服务器决定
+//
+// 返回:
+//   - imap.UID: 服务器分配的UID，服务器不支持UIDPLUS(APPENDUID)时为0
+//   - error: 上传过程中的错误
+func (c *ImapClient) Append(mailbox string, r io.Reader, flags []imap.Flag, date time.Time) (imap.UID, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	// APPEND需要预先知道邮件大小，无法获取时先读入内存
+	size, ok := readerSize(r)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return 0, fmt.Errorf("read message: %w", err)
+		}
+		r = bytes.NewReader(data)
+		size = int64(len(data))
+	}
+
+	c.lock()
+	defer c.unlock()
+
+	// APPEND不是幂等的，断线后重新上传可能产生重复邮件，因此只在发送前检查连接
+	if err := c.ensureConn(); err != nil {
+		return 0, err
+	}
+
+	cmd := c.client.Append(mailbox, size, &imap.AppendOptions{
+		Flags: flags,
+		Time:  date,
+	})
+	if _, err := io.CopyN(cmd, r, size); err != nil {
+		cmd.Close()
+		return 0, fmt.Errorf("write message: %w", err)
+	}
+	if err := cmd.Close(); err != nil {
+		return 0, err
+	}
+
+	data, err := cmd.Wait()
+	if err != nil {
+		return 0, err
+	}
+
+	return data.UID, nil
+}
+
+// AppendMessage 将构建好的邮件上传到指定邮箱，常用于保存到"已发送"或草稿箱
+// 参数:
+//   - mailbox: 目标邮箱名称，默认为"INBOX"
+//   - msg: 要上传的邮件
+//   - flags: 邮件标志，可为nil
+//   - date: 邮件的内部日期，零值表示由服务器决定
+//
+// 返回:
+//   - imap.UID: 服务器分配的UID，服务器不支持UIDPLUS时为0
+//   - error: 上传过程中的错误
+func (c *ImapClient) AppendMessage(mailbox string, msg *OutgoingMessage, flags []imap.Flag, date time.Time) (imap.UID, error) {
+	data, err := msg.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	return c.Append(mailbox, bytes.NewReader(data), flags, date)
+}
+
+// AppendItem 批量上传中的一封邮件
+type AppendItem struct {
+	Reader io.Reader   // 邮件原始内容
+	Flags  []imap.Flag // 邮件标志
+	Date   time.Time   // 邮件的内部日期
+}
+
+// AppendAll 将多封邮件上传到同一个邮箱
+// 服务器支持MULTIAPPEND时在一条APPEND命令中上传全部邮件，要么全部成功，要么都不保存；
+// 底层库未实现MULTIAPPEND，因此该命令通过辅助连接发送。
+// 服务器不支持时逐封发送APPEND命令，遇到错误立即返回
+// 参数:
+//   - mailbox: 目标邮箱名称，默认为"INBOX"
+//   - items: 要上传的邮件列表
+//
+// 返回:
+//   - []imap.UID: 已成功上传的邮件的UID，顺序与items一致；服务器不支持UIDPLUS时均为0
+//   - error: 上传过程中的错误
+func (c *ImapClient) AppendAll(mailbox string, items []*AppendItem) ([]imap.UID, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if len(items) > 1 && c.HasCapability(imap.CapMultiAppend) {
+		return c.multiAppend(mailbox, items)
+	}
+
+	uids := make([]imap.UID, 0, len(items))
+	for i, item := range items {
+		uid, err := c.Append(mailbox, item.Reader, item.Flags, item.Date)
+		if err != nil {
+			return uids, fmt.Errorf("append message %d: %w", i, err)
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// multiAppend 使用MULTIAPPEND(RFC 3502)一次上传多封邮件
+func (c *ImapClient) multiAppend(mailbox string, items []*AppendItem) ([]imap.UID, error) {
+	args := []any{"APPEND", quoteIMAP(encodeMailboxName(mailbox))}
+	for i, item := range items {
+		r := item.Reader
+		size, ok := readerSize(r)
+		if !ok {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("read message %d: %w", i, err)
+			}
+			r = bytes.NewReader(data)
+			size = int64(len(data))
+		}
+
+		if len(item.Flags) > 0 {
+			flags := make([]string, len(item.Flags))
+			for j, flag := range item.Flags {
+				flags[j] = string(flag)
+			}
+			args = append(args, "("+strings.Join(flags, " ")+")")
+		}
+		if !item.Date.IsZero() {
+			args = append(args, quoteIMAP(item.Date.Format(appendDateLayout)))
+		}
+		args = append(args, &rawStream{R: r, Size: size})
+	}
+
+	var text string
+	err := c.withRawOnce(func(raw *rawIMAP) (err error) {
+		_, text, err = raw.run(args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := parseAppendUID(text)
+	if len(uids) != len(items) {
+		// 服务器不支持UIDPLUS
+		uids = make([]imap.UID, len(items))
+	}
+	return uids, nil
+}
+
+// appendDateLayout APPEND命令中INTERNALDATE的格式
+const appendDateLayout = "02-Jan-2006 15:04:05 -0700"
+
+// parseAppendUID 从APPEND的完成响应中解析APPENDUID(RFC 4315)分配的UID
+// 如"[APPENDUID 38505 3955:3957] APPEND completed"，没有APPENDUID时返回nil
+func parseAppendUID(text string) []imap.UID {
+	fields := strings.Fields(strings.TrimPrefix(text, "["))
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "APPENDUID") {
+		return nil
+	}
+
+	set, err := parseUIDSet(strings.TrimSuffix(fields[2], "]"))
+	if err != nil {
+		return nil
+	}
+	uids, _ := set.Nums()
+	return uids
+}
+
+// readerSize 尝试获取Reader中剩余数据的长度
+func readerSize(r io.Reader) (int64, bool) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len()), true
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
@@ -0,0 +1,255 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxFilenameLength 保存附件时文件名的最大长度（字节）
+const maxFilenameLength = 200
+
+// Attachment 邮件附件结构
+// 小附件的内容保存在Data中；超过内存阈值的附件写入临时文件，
+// 通过IMAP GetEmailHeaders获取的附件则在调用Open时才从服务器下载。
+// 无论哪种情况都应通过Open读取内容，使用完毕后调用Close释放临时文件
+type Attachment struct {
+	Filename    string // 附件文件名
+	ContentType string // 附件内容类型，如"application/pdf"
+	Data        []byte // 附件二进制数据，附件未保存在内存中时为nil
+	Size        int64  // 附件大小（字节），按需下载的附件为编码后的大小
+
+	tempFile string                        // 保存附件内容的临时文件
+	open     func() (io.ReadCloser, error) // 按需从服务器读取附件内容
+}
+
+// Open 打开附件内容
+// 调用方需要关闭返回的Reader
+func (a *Attachment) Open() (io.ReadCloser, error) {
+	switch {
+	case a.tempFile != "":
+		return os.Open(a.tempFile)
+	case a.open != nil:
+		return a.open()
+	default:
+		return io.NopCloser(bytes.NewReader(a.Data)), nil
+	}
+}
+
+// InMemory 附件内容是否已全部保存在Data中
+func (a *Attachment) InMemory() bool {
+	return a.tempFile == "" && a.open == nil
+}
+
+// Bytes 读取附件的全部内容
+// 对于大附件会将其全部读入内存，应优先使用Open或SaveTo
+func (a *Attachment) Bytes() ([]byte, error) {
+	if a.InMemory() {
+		return a.Data, nil
+	}
+	r, err := a.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// SaveTo 将附件保存到指定目录
+// 文件名会去除路径分隔符和控制字符，同名文件已存在时自动添加序号
+// 参数:
+//   - dir: 目标目录，不存在时自动创建
+//
+// 返回:
+//   - string: 保存后的文件路径
+//   - error: 保存过程中的错误
+func (a *Attachment) SaveTo(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	r, err := a.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	name := SanitizeFilename(a.Filename)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", err
+		}
+		return path, f.Close()
+	}
+}
+
+// Close 释放附件占用的临时文件
+func (a *Attachment) Close() error {
+	if a.tempFile == "" {
+		return nil
+	}
+	err := os.Remove(a.tempFile)
+	a.tempFile = ""
+	return err
+}
+
+// CloseAttachments 释放邮件中所有附件占用的临时文件
+func (m *ParsedMessage) CloseAttachments() error {
+	var firstErr error
+	for _, a := range m.Attachments {
+		if err := a.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SanitizeFilename 清理附件文件名，使其可以安全地保存到本地
+// 去除目录部分、路径分隔符和控制字符，并限制长度
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base("/" + name)
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.Trim(name, " .")
+	if name == "" {
+		name = "attachment"
+	}
+
+	// Windows保留的设备名
+	upper := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	switch upper {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		name = "_" + name
+	}
+
+	if len(name) > maxFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		runes := []rune(strings.TrimSuffix(name, ext))
+		for len(string(runes))+len(ext) > maxFilenameLength {
+			runes = runes[:len(runes)-1]
+		}
+		name = string(runes) + ext
+	}
+
+	return name
+}
+
+// newAttachment 从Reader创建附件
+// 内容不超过limit时保存在内存中，否则写入临时文件；limit<=0表示始终保存在内存中
+func newAttachment(filename, contentType string, r io.Reader, limit int64) (*Attachment, error) {
+	a := &Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+	}
+
+	if limit <= 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		a.Data = data
+		a.Size = int64(len(data))
+		return a, nil
+	}
+
+	// 先读取limit+1字节，判断是否超出阈值
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, limit+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n <= limit {
+		a.Data = buf.Bytes()
+		a.Size = n
+		return a, nil
+	}
+
+	f, err := os.CreateTemp("", "go-email-attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, io.MultiReader(&buf, r))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	a.tempFile = f.Name()
+	a.Size = size
+	return a, nil
+}
+
+// defaultSpoolLimit 没有设置附件内存阈值时，按需下载的MIME部分保存在内存中的最大字节数
+const defaultSpoolLimit = 1 << 20
+
+// spool 读出r的全部内容，不超过limit字节时保存在内存中，否则写入临时文件
+// 返回的Reader关闭时删除临时文件
+func spool(r io.Reader, limit int64) (io.ReadCloser, error) {
+	a, err := newAttachment("", "", r, limit)
+	if err != nil {
+		return nil, err
+	}
+	if a.InMemory() {
+		return io.NopCloser(bytes.NewReader(a.Data)), nil
+	}
+	f, err := os.Open(a.tempFile)
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	return &spoolFile{File: f, attachment: a}, nil
+}
+
+// spoolFile 临时文件中的内容，关闭时删除临时文件
+type spoolFile struct {
+	*os.File
+	attachment *Attachment
+}
+
+func (f *spoolFile) Close() error {
+	err := f.File.Close()
+	if removeErr := f.attachment.Close(); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -2,8 +2,6 @@ package email
 
 import (
 	"fmt"
-
-	"github.com/emersion/go-imap/v2/imapclient"
 )
 
 // EmailClient 基础邮件客户端接口
@@ -19,6 +17,11 @@ type EmailReader interface {
 	MonitEmail(opt ...any) ([]*ParsedMessage, error)
 }
 
+// MailboxStatusReader 可以获取邮箱状态的客户端，ImapClient和POP3Client都实现了该接口
+type MailboxStatusReader interface {
+	GetMailboxStatus(mailbox string) (*MailboxStatus, error)
+}
+
 // EmailSender 邮件发送接口
 type EmailSender interface {
 	EmailClient
@@ -27,45 +30,21 @@ type EmailSender interface {
 
 // createIMAPClient 创建IMAP客户端
 func createIMAPClient(data LoginParams) (EmailReader, error) {
-	client, err := imapclient.DialTLS(fmt.Sprintf("%s:%d", data.Host, data.Port), nil)
+	c := newImapClient(data)
+	client, err := c.connect()
 	if err != nil {
 		return nil, err
 	}
-
-	switch data.Host {
-	case "outlook.office365.com":
-		token, err := getAccessTokenFromRefreshToken(data.RefreshToken, data.ClientId)
-		if err != nil {
-			return nil, err
-		}
-		if token["code"].(int) != 0 {
-			return nil, err
-		}
-
-		accessToken := token["access_token"].(string)
-		auth := &XOAUTH2Authenticator{
-			Username:    data.User,
-			AccessToken: accessToken,
-		}
-		if err := client.Authenticate(auth); err != nil {
-			return nil, err
-		}
-	default:
-		err = client.Login(data.User, data.Pwd).Wait()
-		if err != nil {
-			client.Close()
-			return nil, err
-		}
-	}
-	return &ImapClient{
-		client: client,
-	}, nil
+	c.setClient(client)
+	return c, nil
 }
 
 // createPOP3Client 创建POP3客户端
 func createPOP3Client(data LoginParams) (EmailReader, error) {
 	// 创建POP3客户端实例
 	client := NewPOP3Client(data.Host, data.Port, data.User, data.Pwd)
+	client.login = &data
+	client.SetAttachmentMemLimit(data.AttachmentMemLimit)
 
 	// 连接并登录
 	err := client.Connect()
@@ -79,6 +58,7 @@ func createPOP3Client(data LoginParams) (EmailReader, error) {
 // createSMTPClient 创建SMTP客户端
 func createSMTPClient(data LoginParams) (EmailSender, error) {
 	client := NewSMTPClient(data.Host, data.Port, data.User, data.Pwd)
+	client.login = &data
 	return client, nil
 }
 
@@ -91,6 +71,8 @@ func AutoLogin(data LoginParams) (EmailClient, error) {
 		return createPOP3Client(data)
 	case SMTP:
 		return createSMTPClient(data)
+	case SIEVE:
+		return SieveConnect(data)
 	default:
 		return nil, fmt.Errorf("unsupported protocol: %d", data.Proto)
 	}
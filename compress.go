@@ -0,0 +1,196 @@
+package email
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// capCompressDeflate COMPRESS扩展的DEFLATE算法(RFC 4978)
+const capCompressDeflate = "COMPRESS=DEFLATE"
+
+// CompressStats COMPRESS=DEFLATE的流量统计，累计了断线重连之前的连接
+type CompressStats struct {
+	Enabled  bool  // 当前连接是否启用了压缩
+	BytesIn  int64 // 解压后收到的字节数
+	BytesOut int64 // 压缩前发送的字节数
+	WireIn   int64 // 压缩后实际收到的字节数
+	WireOut  int64 // 压缩后实际发送的字节数
+}
+
+// Saved 压缩节省的字节数
+func (s CompressStats) Saved() int64 {
+	return s.BytesIn + s.BytesOut - s.WireIn - s.WireOut
+}
+
+// Ratio 实际传输的字节数与未压缩字节数之比，越小表示压缩效果越好；没有流量时返回1
+func (s CompressStats) Ratio() float64 {
+	if s.BytesIn+s.BytesOut == 0 {
+		return 1
+	}
+	return float64(s.WireIn+s.WireOut) / float64(s.BytesIn+s.BytesOut)
+}
+
+// compressCounters 压缩流量计数器，可以被读写两个方向同时更新
+type compressCounters struct {
+	enabled  atomic.Bool
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	wireIn   atomic.Int64
+	wireOut  atomic.Int64
+}
+
+// CompressStats 返回COMPRESS=DEFLATE的流量统计
+// 只统计启用了压缩的连接；登录之前的流量不计入
+func (c *ImapClient) CompressStats() CompressStats {
+	return CompressStats{
+		Enabled:  c.compress.enabled.Load(),
+		BytesIn:  c.compress.bytesIn.Load(),
+		BytesOut: c.compress.bytesOut.Load(),
+		WireIn:   c.compress.wireIn.Load(),
+		WireOut:  c.compress.wireOut.Load(),
+	}
+}
+
+// connectCompressed 连接服务器并登录，服务器支持COMPRESS=DEFLATE时启用压缩
+// imapclient不支持COMPRESS，也无法在命令之间替换底层的读写流，因此问候、STARTTLS、
+// 登录和COMPRESS命令通过rawIMAP完成，再以PREAUTH问候将已认证的连接交给imapclient
+func (c *ImapClient) connectCompressed() (*imapclient.Client, error) {
+	conn, err := dialConn(c.login)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := newRawIMAP(conn, c.login)
+	if err != nil {
+		return nil, err
+	}
+	if err := raw.login(c.login); err != nil {
+		raw.conn.Close()
+		return nil, err
+	}
+	caps, err := raw.capabilities()
+	if err != nil {
+		raw.conn.Close()
+		return nil, err
+	}
+
+	conn = raw.conn
+	var buffered []byte
+	c.compress.enabled.Store(false)
+	if hasRawCap(caps, capCompressDeflate) {
+		_, err := raw.command("COMPRESS", "DEFLATE")
+		var statusErr *rawStatusError
+		switch {
+		case err == nil:
+			conn = newDeflateConn(conn, readBuffered(raw), &c.compress)
+			c.compress.enabled.Store(true)
+		case !errors.As(err, &statusErr):
+			raw.conn.Close()
+			return nil, err
+		}
+	}
+	if !c.compress.enabled.Load() {
+		buffered = readBuffered(raw)
+	}
+	raw.conn.SetDeadline(time.Time{})
+
+	// 登录后的能力放在问候中，imapclient不必再次查询
+	greeting := "* PREAUTH [CAPABILITY " + strings.Join(caps, " ") + "] ready\r\n"
+	pending := append([]byte(greeting), buffered...)
+	return imapclient.New(&replayConn{Conn: conn, pending: pending}, c.clientOptions()), nil
+}
+
+// readBuffered 取出rawIMAP已读入缓冲区但尚未处理的数据
+func readBuffered(raw *rawIMAP) []byte {
+	n := raw.r.Buffered()
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	io.ReadFull(raw.r, buf)
+	return buf
+}
+
+// hasRawCap 能力列表中是否包含cap（忽略大小写）
+func hasRawCap(caps []string, cap string) bool {
+	for _, c := range caps {
+		if strings.EqualFold(c, cap) {
+			return true
+		}
+	}
+	return false
+}
+
+// deflateConn 以DEFLATE(RFC 1951)压缩读写的连接
+// 每次写入后都进行同步刷新，使对方可以立即解压出完整的命令
+type deflateConn struct {
+	net.Conn
+	r     io.ReadCloser
+	w     *flate.Writer
+	stats *compressCounters
+}
+
+// newDeflateConn 包装已协商压缩的连接，buffered为已从连接读出的压缩数据
+func newDeflateConn(conn net.Conn, buffered []byte, stats *compressCounters) *deflateConn {
+	in := io.MultiReader(bytes.NewReader(buffered), &countingReader{r: conn, n: &stats.wireIn})
+	stats.wireIn.Add(int64(len(buffered)))
+
+	w, _ := flate.NewWriter(&countingWriter{w: conn, n: &stats.wireOut}, flate.DefaultCompression)
+	return &deflateConn{
+		Conn:  conn,
+		r:     flate.NewReader(in),
+		w:     w,
+		stats: stats,
+	}
+}
+
+func (c *deflateConn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.stats.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (c *deflateConn) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	c.stats.bytesOut.Add(int64(n))
+	return n, err
+}
+
+func (c *deflateConn) Close() error {
+	c.r.Close()
+	return c.Conn.Close()
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(int64(n))
+	return n, err
+}
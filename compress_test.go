@@ -0,0 +1,143 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeflateConnRoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	var statsA, statsB compressCounters
+	client := newDeflateConn(a, nil, &statsA)
+	server := newDeflateConn(b, nil, &statsB)
+	defer client.Close()
+	defer server.Close()
+
+	commands := []string{
+		"A1 NOOP\r\n",
+		"A2 UID FETCH 1:* (FLAGS)\r\n",
+		"A3 APPEND INBOX {1000}\r\n" + strings.Repeat("x", 1000) + "\r\n",
+	}
+
+	// 服务器逐行读取命令并原样返回
+	go func() {
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if _, err := server.Write([]byte("* " + line)); err != nil {
+				return
+			}
+		}
+	}()
+
+	r := bufio.NewReader(client)
+	var sent int
+	for _, cmd := range commands {
+		if _, err := client.Write([]byte(cmd)); err != nil {
+			t.Fatal(err)
+		}
+		sent += len(cmd)
+		for _, want := range strings.SplitAfter(cmd, "\r\n") {
+			if want == "" {
+				continue
+			}
+			got, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "* "+want {
+				t.Fatalf("got %q, want %q", got, "* "+want)
+			}
+		}
+	}
+
+	if n := statsA.bytesOut.Load(); n != int64(sent) {
+		t.Errorf("client bytesOut = %d, want %d", n, sent)
+	}
+	if n := statsB.bytesIn.Load(); n != int64(sent) {
+		t.Errorf("server bytesIn = %d, want %d", n, sent)
+	}
+	if statsA.wireOut.Load() != statsB.wireIn.Load() {
+		t.Errorf("client wireOut = %d, server wireIn = %d", statsA.wireOut.Load(), statsB.wireIn.Load())
+	}
+	if statsA.wireOut.Load() >= statsA.bytesOut.Load() {
+		t.Errorf("no compression: wire %d, bytes %d", statsA.wireOut.Load(), statsA.bytesOut.Load())
+	}
+}
+
+// 协商压缩时已读入缓冲区的压缩数据应先于连接中的数据被解压
+func TestDeflateConnBuffered(t *testing.T) {
+	data := strings.Repeat("* 1 FETCH (FLAGS (\\Seen))\r\n", 50)
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	w.Write([]byte(data))
+	w.Flush()
+	wire := compressed.Bytes()
+	split := len(wire) / 3
+
+	a, b := net.Pipe()
+	defer b.Close()
+	var stats compressCounters
+	conn := newDeflateConn(a, wire[:split], &stats)
+	defer conn.Close()
+	go b.Write(wire[split:])
+
+	got := make([]byte, len(data))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Fatalf("got %q", got)
+	}
+	if n := stats.wireIn.Load(); n != int64(len(wire)) {
+		t.Errorf("wireIn = %d, want %d", n, len(wire))
+	}
+	if n := stats.bytesIn.Load(); n != int64(len(data)) {
+		t.Errorf("bytesIn = %d, want %d", n, len(data))
+	}
+}
+
+// 服务器不支持COMPRESS时，默认设置和关闭压缩的客户端都应照常工作
+func TestCompressUnsupported(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		port := startTestServer(t, nil)
+		client, err := AutoLoginReader(LoginParams{
+			Host:            "127.0.0.1",
+			Port:            port,
+			User:            "user",
+			Pwd:             "pass",
+			Proto:           IMAP,
+			TLSMode:         TLSNone,
+			DisableCompress: disable,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := client.(*ImapClient)
+		defer c.Close()
+
+		if _, err := c.Append("INBOX", strings.NewReader(testMessage("plain")), nil, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := c.GetEmail(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].Subject != "plain" {
+			t.Fatalf("DisableCompress=%v: got %d messages", disable, len(msgs))
+		}
+		if c.CompressStats().Enabled {
+			t.Errorf("DisableCompress=%v: compression enabled without server support", disable)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// TLSMode 连接服务器时使用的加密方式
+type TLSMode int
+
+const (
+	// TLSAuto 根据端口选择：IMAP 143、POP3 110和ManageSieve使用STARTTLS；SMTP 465使用隐式TLS，
+	// 其他SMTP端口在服务器支持时使用STARTTLS；其余端口使用隐式TLS
+	TLSAuto TLSMode = iota
+	// TLSImplicit 连接建立后立即进行TLS握手，如IMAP 993、POP3 995、SMTP 465
+	TLSImplicit
+	// TLSStartTLS 先以明文连接，再通过STARTTLS(POP3为STLS)升级为TLS，服务器不支持时报错
+	TLSStartTLS
+	// TLSNone 不加密，仅用于本地测试服务器；密码会以明文传输
+	TLSNone
+)
+
+// defaultDialTimeout 建立TCP连接的超时时间
+const defaultDialTimeout = 30 * time.Second
+
+// String 返回加密方式的名称
+func (m TLSMode) String() string {
+	switch m {
+	case TLSAuto:
+		return "auto"
+	case TLSImplicit:
+		return "tls"
+	case TLSStartTLS:
+		return "starttls"
+	case TLSNone:
+		return "none"
+	}
+	return fmt.Sprintf("TLSMode(%d)", int(m))
+}
+
+// address 服务器地址，格式为"host:port"
+func (data *LoginParams) address() string {
+	return net.JoinHostPort(data.Host, fmt.Sprint(data.Port))
+}
+
+// tlsMode 实际使用的加密方式，TLSAuto会根据协议和端口确定
+// SMTP在非465端口上返回TLSAuto，表示服务器支持时才使用STARTTLS
+func (data *LoginParams) tlsMode() TLSMode {
+	if data.TLSMode != TLSAuto {
+		return data.TLSMode
+	}
+	switch {
+	case data.Proto == IMAP && data.Port == 143, data.Proto == POP3 && data.Port == 110, data.Proto == SIEVE:
+		return TLSStartTLS
+	case data.Proto == SMTP && data.Port != 465:
+		return TLSAuto
+	}
+	return TLSImplicit
+}
+
+// alpnProtocols 各协议在TLS握手时声明的ALPN协议名(RFC 7301)
+var alpnProtocols = map[EmailProto]string{
+	IMAP:  "imap",
+	POP3:  "pop3",
+	SIEVE: "managesieve",
+}
+
+// tlsConfig 连接使用的TLS配置，未指定ServerName时使用服务器主机名
+func (data *LoginParams) tlsConfig() *tls.Config {
+	var config *tls.Config
+	if data.TLSConfig != nil {
+		config = data.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = data.Host
+	}
+	if proto, ok := alpnProtocols[data.Proto]; ok && config.NextProtos == nil {
+		config.NextProtos = []string{proto}
+	}
+	return config
+}
+
+// dialTCP 建立到服务器的TCP连接，设置了Dialer时通过它连接
+func dialTCP(data *LoginParams) (net.Conn, error) {
+	if data.Dialer == nil {
+		dialer := &net.Dialer{Timeout: defaultDialTimeout}
+		return dialer.Dial("tcp", data.address())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+	defer cancel()
+	return data.Dialer.DialContext(ctx, "tcp", data.address())
+}
+
+// dialConn 建立到服务器的连接，使用隐式TLS时会完成TLS握手；
+// STARTTLS由各协议在读取问候后自行处理
+func dialConn(data *LoginParams) (net.Conn, error) {
+	conn, err := dialTCP(data)
+	if err != nil {
+		return nil, err
+	}
+	if data.tlsMode() != TLSImplicit {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, data.tlsConfig())
+	tlsConn.SetDeadline(time.Now().Add(defaultDialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// pop3Dialer 为go-pop3建立连接，按登录参数处理隐式TLS和STLS(RFC 2595)
+// 返回的连接每次最多读取一行，go-pop3读完状态行后不会缓存后续数据，
+// 因此多行响应可以直接从conn中以流的方式读取
+type pop3Dialer struct {
+	login *LoginParams
+	conn  *lineConn // 最近一次建立的连接
+}
+
+// Dial 建立连接；使用STLS时在返回前完成升级，并重放一条问候供go-pop3读取
+func (d *pop3Dialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+	d.conn = &lineConn{Conn: conn, r: bufio.NewReader(conn)}
+	return d.conn, nil
+}
+
+// dial 建立连接并完成TLS协商
+func (d *pop3Dialer) dial() (net.Conn, error) {
+	conn, err := dialConn(d.login)
+	if err != nil {
+		return nil, err
+	}
+	if d.login.tlsMode() != TLSStartTLS {
+		return conn, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(defaultDialTimeout))
+	r := bufio.NewReader(conn)
+	greeting, err := readPOP3Line(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := readPOP3Line(r); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("STLS: %w", err)
+	}
+
+	tlsConn := tls.Client(conn, d.login.tlsConfig())
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return &replayConn{Conn: tlsConn, pending: []byte(greeting + "\r\n")}, nil
+}
+
+// readPOP3Line 读取一行响应，-ERR时返回错误
+func readPOP3Line(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "+OK") {
+		return "", fmt.Errorf("pop3: %s", line)
+	}
+	return line, nil
+}
+
+// replayConn 在读取底层连接之前先返回pending中的数据
+type replayConn struct {
+	net.Conn
+	pending []byte
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// lineConn 每次Read最多返回一行数据的连接，一行之后的数据保留在r中
+type lineConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *lineConn) Read(b []byte) (int, error) {
+	if c.r.Buffered() == 0 {
+		if _, err := c.r.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	buf, _ := c.r.Peek(c.r.Buffered())
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	}
+	n := copy(b, buf)
+	c.r.Discard(n)
+	return n, nil
+}
+
+// dotReader 读取POP3多行响应(RFC 1939)的内容，去除点填充，读到结束行"."时返回io.EOF
+type dotReader struct {
+	r    *bufio.Reader
+	line []byte // 当前行未读取的部分
+	mid  bool   // 上一次读取的行超过缓冲区大小，还没有读完
+	done bool
+}
+
+func (d *dotReader) Read(b []byte) (int, error) {
+	for len(d.line) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		line, err := d.r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if !d.mid && len(line) > 0 && line[0] == '.' {
+			if s := string(line); s == ".\r\n" || s == ".\n" {
+				d.done = true
+				continue
+			}
+			line = line[1:]
+		}
+		d.mid = err == bufio.ErrBufferFull
+		d.line = line
+	}
+
+	n := copy(b, d.line)
+	d.line = d.line[n:]
+	return n, nil
+}
@@ -78,7 +78,7 @@ func IMAP() {
 	defer client.Close()
 
 	// 获取邮箱状态
-	status, err := client.GetMailboxStatus("INBOX")
+	status, err := client.(email.MailboxStatusReader).GetMailboxStatus("INBOX")
 	if err != nil {
 		log.Error(err)
 		return
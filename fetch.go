@@ -0,0 +1,217 @@
+package email
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message"
+)
+
+// snippetLength ParsedMessage.Snippet的最大字符数
+const snippetLength = 200
+
+// FetchOptions 获取邮件时的可选设置，作为GetEmail的参数传入
+// 用于预览列表等只需要正文开头的场景，避免下载大邮件
+type FetchOptions struct {
+	PartialBytes int64 // 只获取正文(BODY.PEEK[TEXT])的前N字节，如4096；0表示获取完整邮件。只获取部分正文时不解析附件
+	MaxSize      int64 // RFC822.SIZE超过该值的邮件不下载正文，只返回摘要信息和MIME结构；0表示不限制
+	KeepRaw      bool  // 在ParsedMessage.Raw中保留邮件的原始内容；只获取部分正文时无效
+}
+
+// partialHeaderSection 只获取部分正文时单独获取的邮件头，解析多部分邮件的边界需要它
+var partialHeaderSection = &imap.FetchItemBodySection{
+	Specifier: imap.PartSpecifierHeader,
+	Peek:      true,
+}
+
+// partialTextSection 从开头获取size字节的正文
+func partialTextSection(size int64) *imap.FetchItemBodySection {
+	return &imap.FetchItemBodySection{
+		Specifier: imap.PartSpecifierText,
+		Peek:      true,
+		Partial:   &imap.SectionPartial{Offset: 0, Size: size},
+	}
+}
+
+// imapOptions 返回获取邮件内容的FETCH选项
+func (o *FetchOptions) imapOptions() *imap.FetchOptions {
+	options := &imap.FetchOptions{
+		Flags:        true,
+		InternalDate: true,
+		RFC822Size:   true,
+		Envelope:     true,
+		UID:          true,
+		BodySection: []*imap.FetchItemBodySection{
+			{}, // 获取完整邮件
+		},
+	}
+	if o.PartialBytes > 0 {
+		options.BodySection = []*imap.FetchItemBodySection{
+			partialHeaderSection,
+			partialTextSection(o.PartialBytes),
+		}
+	}
+	return options
+}
+
+// fetchMessages 获取并解析numSet中的邮件，keepRaw为true时保留获取到的完整邮件原始内容
+// 服务器支持Gmail扩展时同时填入ParsedMessage.Gmail
+func (c *ImapClient) fetchMessages(numSet imap.NumSet, options *imap.FetchOptions, keepRaw bool) ([]*ParsedMessage, error) {
+	cmd := c.client.Fetch(numSet, options)
+	defer cmd.Close()
+
+	var messages []*ParsedMessage
+	for msg := cmd.Next(); msg != nil; msg = cmd.Next() {
+		parsedMsg, err := c.parseMessage(msg, keepRaw)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, parsedMsg)
+	}
+	if err := cmd.Close(); err != nil {
+		return nil, err
+	}
+	c.fillGmailInfo(c.mailbox, messages)
+	return messages, nil
+}
+
+// fetchLimited 先获取邮件大小，只下载不超过MaxSize的邮件，
+// 超过的邮件只获取摘要信息并标记为Partial，结果按UID排序
+func (c *ImapClient) fetchLimited(numSet imap.NumSet, options *FetchOptions) ([]*ParsedMessage, error) {
+	sizes, err := c.client.Fetch(numSet, &imap.FetchOptions{
+		UID:        true,
+		RFC822Size: true,
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var small, large imap.UIDSet
+	for _, buf := range sizes {
+		if buf.RFC822Size > options.MaxSize {
+			large.AddNum(buf.UID)
+		} else {
+			small.AddNum(buf.UID)
+		}
+	}
+
+	var messages []*ParsedMessage
+	if len(small) > 0 {
+		msgs, err := c.fetchMessages(small, options.imapOptions(), options.KeepRaw)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msgs...)
+	}
+	if len(large) > 0 {
+		msgs, err := c.fetchMessages(large, headersFetchOptions(), false)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			msg.Partial = true
+		}
+		messages = append(messages, msgs...)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].UID < messages[j].UID
+	})
+	return messages, nil
+}
+
+// parsePartialBody 解析被截断的正文，只提取纯文本和HTML正文，不解析附件
+// header为完整的邮件头，text为正文的开头部分
+func parsePartialBody(parsedMsg *ParsedMessage, header, text []byte) error {
+	entity, err := message.Read(io.MultiReader(bytes.NewReader(header), bytes.NewReader(text)))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return err
+	}
+	readPartialEntity(parsedMsg, entity)
+
+	parsedMsg.Partial = int64(len(header)+len(text)) < parsedMsg.Size
+	parsedMsg.Snippet = makeSnippet(parsedMsg.TextBody, parsedMsg.HTMLBody)
+	return nil
+}
+
+// readPartialEntity 递归读取被截断的邮件实体中的第一个纯文本和HTML正文
+// 截断处缺少结束边界，读取出错时保留已读到的内容
+func readPartialEntity(parsedMsg *ParsedMessage, e *message.Entity) {
+	if mr := e.MultipartReader(); mr != nil {
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				return
+			}
+			readPartialEntity(parsedMsg, p)
+		}
+	}
+
+	if disposition, _, _ := e.Header.ContentDisposition(); disposition == "attachment" {
+		return
+	}
+	mediaType, _, _ := e.Header.ContentType()
+	switch mediaType {
+	case "text/plain", "":
+		if parsedMsg.TextBody == "" {
+			data, _ := io.ReadAll(e.Body)
+			parsedMsg.TextBody = strings.ToValidUTF8(string(data), "")
+		}
+	case "text/html":
+		if parsedMsg.HTMLBody == "" {
+			data, _ := io.ReadAll(e.Body)
+			parsedMsg.HTMLBody = strings.ToValidUTF8(string(data), "")
+		}
+	}
+}
+
+var (
+	htmlHiddenRe = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|head|title)\b.*?</(script|style|head|title)\s*>`)
+	htmlTagRe    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlToText 去掉HTML标签、注释、脚本和样式，并解码HTML实体
+func htmlToText(s string) string {
+	s = htmlHiddenRe.ReplaceAllString(s, " ")
+	s = htmlTagRe.ReplaceAllString(s, " ")
+	return html.UnescapeString(s)
+}
+
+// makeSnippet 根据正文生成纯文本摘要：优先使用纯文本正文，没有时从HTML正文中提取文本，
+// 连续的空白合并为一个空格，最多保留snippetLength个字符
+func makeSnippet(textBody, htmlBody string) string {
+	text := textBody
+	if strings.TrimSpace(text) == "" {
+		text = htmlToText(htmlBody)
+	}
+
+	var sb strings.Builder
+	count := 0
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = count > 0
+			continue
+		}
+		if space {
+			if count+1 >= snippetLength {
+				break
+			}
+			sb.WriteByte(' ')
+			count++
+			space = false
+		}
+		sb.WriteRune(r)
+		count++
+		if count >= snippetLength {
+			break
+		}
+	}
+	return strings.ToValidUTF8(sb.String(), "")
+}
@@ -0,0 +1,309 @@
+package email
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/go-enols/go-log"
+)
+
+// capGmailExt Gmail的IMAP扩展(https://developers.google.com/gmail/imap/imap-extensions)
+const capGmailExt imap.Cap = "X-GM-EXT-1"
+
+// ErrGmailUnsupported 服务器不支持Gmail扩展，包装了ErrNotSupported
+var ErrGmailUnsupported = fmt.Errorf("%s: %w", capGmailExt, ErrNotSupported)
+
+// GmailInfo Gmail为每封邮件提供的扩展属性
+// Gmail以文件夹的形式展示标签，同一封邮件会出现在它的每个标签对应的文件夹中，
+// 这些副本的MsgID相同，可以用DedupeGmail去重
+type GmailInfo struct {
+	MsgID    uint64   // X-GM-MSGID，邮件在整个账号中唯一的ID
+	ThreadID uint64   // X-GM-THRID，邮件所属会话的ID
+	Labels   []string // X-GM-LABELS，邮件的标签，系统标签以"\"开头，如"\Inbox"、"\Important"
+}
+
+// IsGmail 服务器是否支持Gmail扩展(X-GM-EXT-1)
+func (c *ImapClient) IsGmail() bool {
+	return c.HasCapability(capGmailExt)
+}
+
+// GetGmailInfo 获取邮件的Gmail标签、邮件ID和会话ID
+// 底层IMAP库无法解析X-GM-*数据项，因此这些命令通过单独的连接发送，该连接在首次使用时建立
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uids: 邮件UID
+//
+// 返回:
+//   - map[imap.UID]*GmailInfo: 以UID为键的扩展属性，不存在的邮件不在其中
+//   - error: 服务器不支持Gmail扩展时返回ErrGmailUnsupported
+func (c *ImapClient) GetGmailInfo(mailbox string, uids []imap.UID) (map[imap.UID]*GmailInfo, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	infos := make(map[imap.UID]*GmailInfo, len(uids))
+	if len(uids) == 0 {
+		return infos, nil
+	}
+
+	err := c.withGmail(func(g *rawIMAP) error {
+		return g.gmailInfo(mailbox, uids, infos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// LoadGmailInfo 获取邮件的Gmail扩展属性并填入ParsedMessage.Gmail
+// 通过GetEmail等方法获取的邮件已自动填入，只有来自其他途径（如离线缓存）的邮件需要调用
+// 参数:
+//   - mailbox: 邮件所在的邮箱，默认为"INBOX"
+//   - messages: 从该邮箱获取的邮件
+//
+// 返回:
+//   - error: 服务器不支持Gmail扩展时返回ErrGmailUnsupported
+func (c *ImapClient) LoadGmailInfo(mailbox string, messages []*ParsedMessage) error {
+	uids := make([]imap.UID, 0, len(messages))
+	for _, msg := range messages {
+		if msg.UID != 0 {
+			uids = append(uids, msg.UID)
+		}
+	}
+
+	infos, err := c.GetGmailInfo(mailbox, uids)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if info, ok := infos[msg.UID]; ok {
+			msg.Gmail = info
+		}
+	}
+	return nil
+}
+
+// AddGmailLabels 为邮件添加Gmail标签
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uids: 邮件UID
+//   - labels: 要添加的标签，系统标签以"\"开头，如"\Starred"
+//
+// 返回:
+//   - error: 服务器不支持Gmail扩展时返回ErrGmailUnsupported
+func (c *ImapClient) AddGmailLabels(mailbox string, uids []imap.UID, labels ...string) error {
+	return c.storeGmailLabels(mailbox, uids, "+X-GM-LABELS.SILENT", labels)
+}
+
+// RemoveGmailLabels 移除邮件的Gmail标签，参数与AddGmailLabels相同
+// 移除当前邮箱对应的标签后，邮件会从该邮箱中消失
+func (c *ImapClient) RemoveGmailLabels(mailbox string, uids []imap.UID, labels ...string) error {
+	return c.storeGmailLabels(mailbox, uids, "-X-GM-LABELS.SILENT", labels)
+}
+
+// storeGmailLabels 修改邮件的标签
+func (c *ImapClient) storeGmailLabels(mailbox string, uids []imap.UID, item string, labels []string) error {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if len(uids) == 0 || len(labels) == 0 {
+		return nil
+	}
+
+	list := make([]string, len(labels))
+	for i, label := range labels {
+		list[i] = formatGmailLabel(label)
+	}
+
+	return c.withGmail(func(g *rawIMAP) error {
+		if err := g.selectMailbox(mailbox, false); err != nil {
+			return err
+		}
+		_, err := g.command("UID STORE", imap.UIDSetNum(uids...).String(), item, "("+strings.Join(list, " ")+")")
+		return err
+	})
+}
+
+// GmailSearch 使用Gmail网页版的搜索语法(X-GM-RAW)搜索邮件
+// 例如"has:attachment larger:5M"、"from:alice@example.com newer_than:7d"
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"；要搜索所有邮件请使用"[Gmail]/All Mail"
+//   - query: 搜索语句
+//
+// 返回:
+//   - []imap.UID: 符合条件的邮件UID
+//   - error: 服务器不支持Gmail扩展时返回ErrGmailUnsupported
+func (c *ImapClient) GmailSearch(mailbox, query string) ([]imap.UID, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	var uids []imap.UID
+	err := c.withGmail(func(g *rawIMAP) error {
+		uids = nil
+		if err := g.selectMailbox(mailbox, true); err != nil {
+			return err
+		}
+
+		var args []any
+		if isASCII(query) {
+			args = []any{"UID SEARCH X-GM-RAW", quoteIMAP(query)}
+		} else {
+			args = []any{"UID SEARCH CHARSET UTF-8 X-GM-RAW", rawLiteral(query)}
+		}
+		responses, err := g.command(args...)
+		if err != nil {
+			return err
+		}
+		for _, resp := range responses {
+			if len(resp) == 0 || !strings.EqualFold(atomString(resp[0]), "SEARCH") {
+				continue
+			}
+			for _, item := range resp[1:] {
+				if uid, err := strconv.ParseUint(atomString(item), 10, 32); err == nil {
+					uids = append(uids, imap.UID(uid))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// DedupeGmail 去除Gmail中因标签而重复出现的邮件，保留每个MsgID第一次出现的邮件
+// 没有Gmail扩展属性的邮件原样保留
+func DedupeGmail(messages []*ParsedMessage) []*ParsedMessage {
+	seen := make(map[uint64]bool, len(messages))
+	out := make([]*ParsedMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Gmail != nil && msg.Gmail.MsgID != 0 {
+			if seen[msg.Gmail.MsgID] {
+				continue
+			}
+			seen[msg.Gmail.MsgID] = true
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// fillGmailInfo 服务器支持Gmail扩展时为刚获取的邮件填入ParsedMessage.Gmail，调用方必须持有会话锁
+// Gmail信息只是附加属性，获取失败时只记录日志，不影响邮件本身
+func (c *ImapClient) fillGmailInfo(mailbox string, messages []*ParsedMessage) {
+	if len(messages) == 0 || !c.client.Caps().Has(capGmailExt) {
+		return
+	}
+
+	uids := make([]imap.UID, 0, len(messages))
+	for _, msg := range messages {
+		if msg.UID != 0 {
+			uids = append(uids, msg.UID)
+		}
+	}
+	if len(uids) == 0 {
+		return
+	}
+
+	infos := make(map[imap.UID]*GmailInfo, len(uids))
+	if err := c.withRaw(func(g *rawIMAP) error {
+		return g.gmailInfo(mailbox, uids, infos)
+	}); err != nil {
+		log.Debugf("fetch gmail info from %s: %v", mailbox, err)
+		return
+	}
+	for _, msg := range messages {
+		if info, ok := infos[msg.UID]; ok {
+			msg.Gmail = info
+		}
+	}
+}
+
+// gmailInfo 获取uids的Gmail扩展属性并存入infos
+func (g *rawIMAP) gmailInfo(mailbox string, uids []imap.UID, infos map[imap.UID]*GmailInfo) error {
+	if err := g.selectMailbox(mailbox, true); err != nil {
+		return err
+	}
+	responses, err := g.command("UID FETCH", imap.UIDSetNum(uids...).String(), "(UID X-GM-MSGID X-GM-THRID X-GM-LABELS)")
+	if err != nil {
+		return err
+	}
+	for _, resp := range responses {
+		if uid, info := parseGmailFetch(resp); uid != 0 {
+			infos[uid] = info
+		}
+	}
+	return nil
+}
+
+// withGmail 使用辅助连接执行Gmail扩展命令
+func (c *ImapClient) withGmail(fn func(g *rawIMAP) error) error {
+	if !c.IsGmail() {
+		return ErrGmailUnsupported
+	}
+	return c.withRaw(fn)
+}
+
+// parseGmailFetch 解析"n FETCH (UID ... X-GM-LABELS (...))"响应
+func parseGmailFetch(resp rawResponse) (imap.UID, *GmailInfo) {
+	if len(resp) < 3 || !strings.EqualFold(atomString(resp[1]), "FETCH") {
+		return 0, nil
+	}
+	items, ok := resp[2].(rawList)
+	if !ok {
+		return 0, nil
+	}
+
+	var uid imap.UID
+	info := &GmailInfo{}
+	for i := 0; i+1 < len(items); i += 2 {
+		value := items[i+1]
+		switch strings.ToUpper(atomString(items[i])) {
+		case "UID":
+			n, _ := strconv.ParseUint(atomString(value), 10, 32)
+			uid = imap.UID(n)
+		case "X-GM-MSGID":
+			info.MsgID, _ = strconv.ParseUint(atomString(value), 10, 64)
+		case "X-GM-THRID":
+			info.ThreadID, _ = strconv.ParseUint(atomString(value), 10, 64)
+		case "X-GM-LABELS":
+			labels, _ := value.(rawList)
+			for _, label := range labels {
+				info.Labels = append(info.Labels, decodeMailboxName(atomString(label)))
+			}
+		}
+	}
+	return uid, info
+}
+
+// formatGmailLabel 将标签编码为命令参数，系统标签以原子形式发送
+func formatGmailLabel(label string) string {
+	if strings.HasPrefix(label, `\`) && !strings.ContainsAny(label, " ()\"") {
+		return label
+	}
+	return quoteIMAP(encodeMailboxName(label))
+}
+
+// atomString 返回原子或字符串的文本
+func atomString(item any) string {
+	switch v := item.(type) {
+	case rawAtom:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// isASCII 字符串是否只包含可打印的ASCII字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package email
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/go-enols/go-log"
+)
+
+// DefaultClientIdentity 登录参数未指定ClientIdentity时发送的客户端信息
+// 部分服务商（如网易163、126邮箱）要求客户端在SELECT之前发送ID，否则返回"Unsafe Login"
+var DefaultClientIdentity = imap.IDData{
+	Name:    "go-email",
+	Version: "1.0",
+	Vendor:  "go-enols",
+	OS:      runtime.GOOS,
+}
+
+// sendID 服务器支持ID扩展(RFC 2971)时发送客户端信息，并记录服务器返回的信息
+// 服务器拒绝ID命令时只记录日志，不影响登录
+func (c *ImapClient) sendID(client *imapclient.Client) error {
+	if !client.Caps().Has(imap.CapID) {
+		return nil
+	}
+
+	identity := c.login.ClientIdentity
+	if identity == nil {
+		identity = &DefaultClientIdentity
+	}
+	serverID, err := client.ID(identity).Wait()
+	if err != nil {
+		var imapErr *imap.Error
+		if errors.As(err, &imapErr) {
+			log.Debugf("ID rejected by %s: %v", c.login.Host, err)
+			return nil
+		}
+		return err
+	}
+	if serverID != nil {
+		c.serverID.Store(serverID)
+	}
+	return nil
+}
+
+// ServerID 返回服务器在ID命令中返回的信息，如服务器软件名称和版本
+// 服务器不支持ID扩展或没有返回信息时为nil
+func (c *ImapClient) ServerID() *imap.IDData {
+	return c.serverID.Load()
+}
+
+// Capabilities 返回服务器当前声明的能力
+// 可用于判断是否支持IDLE、MOVE、CONDSTORE等扩展，如c.Capabilities().Has(imap.CapIdle)。
+// 返回的是副本，修改它不会影响客户端
+func (c *ImapClient) Capabilities() imap.CapSet {
+	caps := make(imap.CapSet)
+	c.withConn(func() error {
+		for capability := range c.client.Caps() {
+			caps[capability] = struct{}{}
+		}
+		return nil
+	})
+	return caps
+}
+
+// HasCapability 服务器是否支持指定的能力
+func (c *ImapClient) HasCapability(capability imap.Cap) bool {
+	return c.Capabilities().Has(capability)
+}
@@ -2,9 +2,14 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emersion/go-imap/v2"
@@ -16,12 +21,42 @@ import (
 
 // ImapClient 封装的 IMAP 客户端
 // 提供了一系列简化的方法用于邮件读取和管理
+//
+// ImapClient可以被多个goroutine同时使用：同一客户端上的所有操作都持有同一把会话锁串行执行，
+// 每个操作都会先选择自己需要的邮箱，因此不同goroutine操作不同邮箱时结果不会互相干扰。
+// Watch运行期间其他调用会暂停IDLE，执行完毕后监听自动恢复。
+// 单个连接上的命令无法并行，需要并行下载大量邮件时请使用ImapPool或多个客户端
 type ImapClient struct {
-	client *imapclient.Client
+	client     *imapclient.Client
+	unilateral *unilateralQueue // 服务器主动推送的数据，供Watch使用
+
+	mu       sync.Mutex    // 会话锁，保护下面的选中状态以及对client的使用
+	waiting  atomic.Int32  // 正在等待会话锁的调用数
+	wake     chan struct{} // 通知Watch暂停IDLE、让出会话锁
+	acquired chan struct{} // 等待会话锁的调用全部拿到锁后通知Watch继续监听
+	connMu   sync.Mutex    // 保护client指针的替换，使Close无需等待会话锁
+
+	login         *LoginParams        // 登录参数，用于断线重连
+	mailbox       string              // 当前选中的邮箱，重连后会重新选择
+	selectOptions *imap.SelectOptions // 选择当前邮箱时使用的选项
+	selected      *imap.SelectData    // 选择当前邮箱时服务器返回的数据
+	selectGen     uint64              // 每次SELECT递增，用于Watch判断邮箱是否被切换过
+	closed        atomic.Bool         // 是否已被调用方关闭
+
+	attachmentMemLimit int64 // 附件保存在内存中的最大字节数，<=0表示不限制
+
+	compress compressCounters            // COMPRESS=DEFLATE流量统计
+	serverID atomic.Pointer[imap.IDData] // 服务器在ID命令中返回的信息
+
+	rawMu sync.Mutex // 保护raw连接
+	raw   *rawIMAP   // 发送底层库不支持的命令（Gmail扩展、MULTIAPPEND等）的辅助连接，首次使用时建立
 }
 
-// 确保ImapClient实现了EmailReader接口
-var _ EmailReader = (*ImapClient)(nil)
+// 确保ImapClient实现了EmailReader和MailboxStatusReader接口
+var (
+	_ EmailReader         = (*ImapClient)(nil)
+	_ MailboxStatusReader = (*ImapClient)(nil)
+)
 
 // Connect 连接到 IMAP 服务器
 // Deprecated: 请使用 AutoLogin 方法替代，此方法将在未来版本中移除
@@ -34,20 +69,50 @@ var _ EmailReader = (*ImapClient)(nil)
 //   - *Client: 连接成功的客户端实例
 //   - error: 连接过程中的错误，如果为nil则表示连接成功
 func ImapConnect(address, username, password string) (*ImapClient, error) {
-	client, err := imapclient.DialTLS(address, nil)
+	host, portStr, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
 	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
 
-	err = client.Login(username, password).Wait()
+	c := newImapClient(LoginParams{
+		Host:  host,
+		Port:  port,
+		User:  username,
+		Pwd:   password,
+		Proto: IMAP,
+	})
+	client, err := c.connect()
 	if err != nil {
-		client.Close()
 		return nil, err
 	}
 
-	return &ImapClient{
-		client: client,
-	}, nil
+	c.setClient(client)
+	return c, nil
+}
+
+// dialIMAP 连接IMAP服务器
+// 内部方法，按登录参数选择加密方式，并为连接安装推送数据处理器，使Watch可以接收服务器推送
+func dialIMAP(c *ImapClient) (*imapclient.Client, error) {
+	conn, err := dialConn(c.login)
+	if err != nil {
+		return nil, err
+	}
+	if c.login.tlsMode() == TLSStartTLS {
+		return imapclient.NewStartTLS(conn, c.clientOptions())
+	}
+	return imapclient.New(conn, c.clientOptions()), nil
+}
+
+// clientOptions 创建imapclient时使用的选项
+func (c *ImapClient) clientOptions() *imapclient.Options {
+	return &imapclient.Options{
+		TLSConfig:             c.login.tlsConfig(),
+		UnilateralDataHandler: c.unilateral.handler(),
+	}
 }
 
 // Close 关闭与IMAP服务器的连接
@@ -55,7 +120,20 @@ func ImapConnect(address, username, password string) (*ImapClient, error) {
 // 返回:
 //   - error: 关闭连接过程中的错误，如果为nil则表示关闭成功
 func (c *ImapClient) Close() error {
-	return c.client.Close()
+	c.closed.Store(true)
+
+	c.connMu.Lock()
+	client := c.client
+	c.connMu.Unlock()
+
+	c.closeRaw()
+	return client.Close()
+}
+
+// SetAttachmentMemLimit 设置附件保存在内存中的最大字节数
+// 超过该大小的附件会写入临时文件，需通过Attachment.Open读取；n<=0表示不限制
+func (c *ImapClient) SetAttachmentMemLimit(n int64) {
+	c.attachmentMemLimit = n
 }
 
 // ListMailboxes 获取所有邮箱列表
@@ -63,6 +141,16 @@ func (c *ImapClient) Close() error {
 //   - []string: 邮箱名称列表，如"INBOX"、"Sent"、"Drafts"等
 //   - error: 获取过程中的错误，如果为nil则表示获取成功
 func (c *ImapClient) ListMailboxes() ([]string, error) {
+	var names []string
+	err := c.withConn(func() (err error) {
+		names, err = c.listMailboxes()
+		return err
+	})
+	return names, err
+}
+
+// listMailboxes ListMailboxes的实现
+func (c *ImapClient) listMailboxes() ([]string, error) {
 	listCmd := c.client.List("", "*", nil)
 	mailboxes, err := listCmd.Collect()
 	if err != nil {
@@ -80,7 +168,11 @@ func (c *ImapClient) ListMailboxes() ([]string, error) {
 // ParsedMessage 解析后的邮件结构
 // 包含了邮件的各种元数据和内容
 type ParsedMessage struct {
+	UID          imap.UID        // 邮件UID，POP3邮件为0
+	Size         int64           // 邮件大小（字节）
 	MessageID    string          // 邮件ID
+	InReplyTo    []string        // In-Reply-To头中的邮件ID
+	References   []string        // References头中的邮件ID，从最早的祖先邮件开始
 	Subject      string          // 邮件主题
 	From         []*mail.Address // 发件人列表
 	To           []*mail.Address // 收件人列表
@@ -88,40 +180,137 @@ type ParsedMessage struct {
 	InternalDate time.Time       // 邮件接收时间
 	TextBody     string          // 纯文本格式的邮件正文
 	HTMLBody     string          // HTML格式的邮件正文
+	Snippet      string          // 由正文生成的纯文本摘要，最多200个字符
+	Partial      bool            // 正文不完整：只获取了部分正文，或邮件超过大小限制而未获取正文
+	Raw          []byte          // 邮件的原始内容(RFC 5322)，仅在设置了FetchOptions.KeepRaw时存在
 	Flags        []imap.Flag     // 邮件标志，如已读、已回复等
 	Attachments  []*Attachment   // 邮件附件列表
-}
-
-// Attachment 邮件附件结构
-type Attachment struct {
-	Filename    string // 附件文件名
-	ContentType string // 附件内容类型，如"application/pdf"
-	Data        []byte // 附件二进制数据
+	Structure    *MIMEPart       // 邮件的MIME结构，仅在获取了BODYSTRUCTURE时存在
+	Gmail        *GmailInfo      // Gmail的标签和会话信息，服务器支持Gmail扩展时获取邮件会自动填入
 }
 
 // parseMessage 解析邮件数据
-// 内部方法，将IMAP邮件数据转换为更易使用的ParsedMessage结构
+// 内部方法，将IMAP邮件数据转换为更易使用的ParsedMessage结构。
+// 完整邮件(BODY[])的内容直接从网络交给MIME解析器，附件按内存阈值写入临时文件，
+// 因此大邮件不会整体读入内存；其他数据项收集后由parseMessageBuffer处理
 // 参数:
 //   - msg: IMAP服务器返回的原始邮件数据
+//   - keepRaw: 是否在ParsedMessage.Raw中保留完整邮件的原始内容
 //
 // 返回:
 //   - *ParsedMessage: 解析后的邮件结构
 //   - error: 解析过程中的错误
-func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
-	buf, err := msg.Collect()
-	if err != nil {
-		return nil, fmt.Errorf("collect message data: %w", err)
+func (c *ImapClient) parseMessage(msg *imapclient.FetchMessageData, keepRaw bool) (*ParsedMessage, error) {
+	buf := &imapclient.FetchMessageBuffer{SeqNum: msg.SeqNum}
+	var body *ParsedMessage
+	var bodyErr error
+	var raw []byte
+	for item := msg.Next(); item != nil; item = msg.Next() {
+		section, ok := item.(imapclient.FetchItemDataBodySection)
+		if !ok || section.Literal == nil || !isFullSection(section.Section) {
+			if err := collectFetchItem(buf, item); err != nil {
+				return nil, fmt.Errorf("collect message data: %w", err)
+			}
+			continue
+		}
+
+		var r io.Reader = section.Literal
+		var rawBuf bytes.Buffer
+		if keepRaw {
+			rawBuf.Grow(int(section.Literal.Size()))
+			r = io.TeeReader(r, &rawBuf)
+		}
+		body = &ParsedMessage{}
+		bodyErr = parseBodyReader(body, r, c.attachmentMemLimit)
+		// 解析出错或MIME结构结束后可能还有未读的内容
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			body.CloseAttachments()
+			return nil, fmt.Errorf("read message body: %w", err)
+		}
+		raw = rawBuf.Bytes()
+	}
+
+	parsedMsg, err := c.parseMessageBuffer(buf)
+	if body == nil {
+		return parsedMsg, err
+	}
+	parsedMsg.TextBody = body.TextBody
+	parsedMsg.HTMLBody = body.HTMLBody
+	parsedMsg.Snippet = body.Snippet
+	parsedMsg.Attachments = body.Attachments
+	if len(parsedMsg.InReplyTo) == 0 {
+		parsedMsg.InReplyTo = body.InReplyTo
+	}
+	if len(parsedMsg.References) == 0 {
+		parsedMsg.References = body.References
+	}
+	if keepRaw {
+		parsedMsg.Raw = raw
+	}
+	if err == nil {
+		err = bodyErr
 	}
+	return parsedMsg, err
+}
+
+// isFullSection 是否为完整邮件(BODY[])，不包括只获取了部分内容的情况
+func isFullSection(section *imap.FetchItemBodySection) bool {
+	return section.Specifier == imap.PartSpecifierNone && len(section.Part) == 0 &&
+		len(section.HeaderFields) == 0 && len(section.HeaderFieldsNot) == 0 && section.Partial == nil
+}
+
+// collectFetchItem 将一个数据项保存到buf中，与FetchMessageData.Collect相同
+func collectFetchItem(buf *imapclient.FetchMessageBuffer, item imapclient.FetchItemData) error {
+	switch item := item.(type) {
+	case imapclient.FetchItemDataBodySection:
+		var b []byte
+		if item.Literal != nil {
+			var err error
+			if b, err = io.ReadAll(item.Literal); err != nil {
+				return err
+			}
+		}
+		buf.BodySection = append(buf.BodySection, imapclient.FetchBodySectionBuffer{
+			Section: item.Section,
+			Bytes:   b,
+		})
+	case imapclient.FetchItemDataFlags:
+		buf.Flags = item.Flags
+	case imapclient.FetchItemDataEnvelope:
+		buf.Envelope = item.Envelope
+	case imapclient.FetchItemDataInternalDate:
+		buf.InternalDate = item.Time
+	case imapclient.FetchItemDataRFC822Size:
+		buf.RFC822Size = item.Size
+	case imapclient.FetchItemDataUID:
+		buf.UID = item.UID
+	case imapclient.FetchItemDataBodyStructure:
+		buf.BodyStructure = item.BodyStructure
+	case imapclient.FetchItemDataModSeq:
+		buf.ModSeq = item.ModSeq
+	}
+	return nil
+}
 
+// parseMessageBuffer 解析已收集的邮件数据
+// 内部方法，与parseMessage相同，但接收FetchCommand.Collect的结果
+func (c *ImapClient) parseMessageBuffer(buf *imapclient.FetchMessageBuffer) (*ParsedMessage, error) {
 	parsedMsg := &ParsedMessage{
+		UID:          buf.UID,
+		Size:         buf.RFC822Size,
 		Flags:        buf.Flags,
 		InternalDate: buf.InternalDate,
 	}
 
+	if buf.BodyStructure != nil {
+		parsedMsg.Structure = newMIMEPart(buf.BodyStructure, nil)
+	}
+
 	// 获取邮件信封信息
 	if buf.Envelope != nil {
 		parsedMsg.Subject = buf.Envelope.Subject
 		parsedMsg.MessageID = buf.Envelope.MessageID
+		parsedMsg.InReplyTo = buf.Envelope.InReplyTo
 
 		// 转换发件人信息
 		for _, addr := range buf.Envelope.From {
@@ -151,6 +340,14 @@ func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
 		}
 	}
 
+	// 只获取了摘要信息时，References来自单独获取的头字段
+	if refs := buf.FindBodySection(referencesSection); refs != nil {
+		if entity, err := message.Read(bytes.NewReader(refs)); err == nil {
+			h := mail.Header{Header: entity.Header}
+			parsedMsg.References, _ = h.MsgIDList("References")
+		}
+	}
+
 	// 获取完整的邮件内容
 	fullSection := &imap.FetchItemBodySection{}
 
@@ -164,19 +361,87 @@ func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
 	}
 
 	if fullBody == nil {
+		// 只获取了正文的开头部分
+		header := buf.FindBodySection(partialHeaderSection)
+		if text := buf.FindBodySection(partialTextSection(0)); header != nil && text != nil {
+			return parsedMsg, parsePartialBody(parsedMsg, header, text)
+		}
 		return parsedMsg, nil
 	}
 
-	// 使用go-message解析邮件内容
-	entity, err := message.Read(bytes.NewReader(fullBody))
+	return parsedMsg, parseBody(parsedMsg, fullBody, c.attachmentMemLimit)
+}
+
+// ParseMessage 解析RFC 5322格式的原始邮件
+// 参数:
+//   - r: 原始邮件内容
+//
+// 返回:
+//   - *ParsedMessage: 解析后的邮件结构，InternalDate取自Date头
+//   - error: 解析过程中的错误
+func ParseMessage(r io.Reader) (*ParsedMessage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mr, err := mail.CreateReader(bytes.NewReader(data))
 	if err != nil {
-		return parsedMsg, fmt.Errorf("read message entity: %w", err)
+		return nil, fmt.Errorf("create mail reader: %w", err)
+	}
+
+	parsedMsg := &ParsedMessage{
+		Size: int64(len(data)),
+	}
+	parsedMsg.Subject, _ = mr.Header.Subject()
+	parsedMsg.MessageID, _ = mr.Header.MessageID()
+	parsedMsg.InternalDate, _ = mr.Header.Date()
+	parsedMsg.From, _ = mr.Header.AddressList("From")
+	parsedMsg.To, _ = mr.Header.AddressList("To")
+	parsedMsg.Cc, _ = mr.Header.AddressList("Cc")
+
+	return parsedMsg, parseBody(parsedMsg, data, 0)
+}
+
+// parseThreadHeaders 从邮件头中读取会话相关的邮件ID，已有的值不会被覆盖
+func parseThreadHeaders(parsedMsg *ParsedMessage, h *mail.Header) {
+	if len(parsedMsg.InReplyTo) == 0 {
+		parsedMsg.InReplyTo, _ = h.MsgIDList("In-Reply-To")
+	}
+	if len(parsedMsg.References) == 0 {
+		parsedMsg.References, _ = h.MsgIDList("References")
+	}
+}
+
+// parseBody 解析邮件正文和附件，填充到parsedMsg中
+// 内部方法，attachmentMemLimit为附件保存在内存中的最大字节数
+func parseBody(parsedMsg *ParsedMessage, fullBody []byte, attachmentMemLimit int64) error {
+	if err := parseBodyReader(parsedMsg, bytes.NewReader(fullBody), attachmentMemLimit); err != nil {
+		return err
+	}
+
+	// 如果正文为空，尝试从邮件实体中提取
+	if parsedMsg.TextBody == "" && parsedMsg.HTMLBody == "" {
+		entity, err := message.Read(bytes.NewReader(fullBody))
+		if err != nil {
+			return fmt.Errorf("read message entity: %w", err)
+		}
+		textBody, htmlBody, _ := extractBodyFromEntity(entity)
+		parsedMsg.TextBody = textBody
+		parsedMsg.HTMLBody = htmlBody
+		parsedMsg.Snippet = makeSnippet(parsedMsg.TextBody, parsedMsg.HTMLBody)
 	}
+	return nil
+}
 
-	mr, err := mail.CreateReader(bytes.NewReader(fullBody))
+// parseBodyReader 以流的方式解析邮件正文和附件，填充到parsedMsg中
+// 内部方法，只读取一遍r；没有内联正文时使用文本类型的附件作为正文
+func parseBodyReader(parsedMsg *ParsedMessage, r io.Reader, attachmentMemLimit int64) error {
+	mr, err := mail.CreateReader(r)
 	if err != nil {
-		return parsedMsg, fmt.Errorf("create mail reader: %w", err)
+		return fmt.Errorf("create mail reader: %w", err)
 	}
+	parseThreadHeaders(parsedMsg, &mr.Header)
 
 	// 遍历解析各个部分
 	for {
@@ -185,7 +450,11 @@ func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
 			break
 		}
 		if err != nil {
-			log.Debug("error reading next part: %v", err)
+			log.Debugf("error reading next part: %v", err)
+			if p == nil {
+				// 无法继续读取后续部分
+				break
+			}
 			continue
 		}
 
@@ -195,7 +464,7 @@ func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
 			contentType := h.Get("Content-Type")
 			data, err := io.ReadAll(p.Body)
 			if err != nil {
-				log.Debug("error reading inline part: %v", err)
+				log.Debugf("error reading inline part: %v", err)
 				continue
 			}
 
@@ -213,28 +482,33 @@ func parseMessage(msg *imapclient.FetchMessageData) (*ParsedMessage, error) {
 			}
 
 			contentType := h.Get("Content-Type")
-			data, err := io.ReadAll(p.Body)
+			attachment, err := newAttachment(filename, contentType, p.Body, attachmentMemLimit)
 			if err != nil {
-				log.Debug("error reading attachment: %v", err)
+				log.Debugf("error reading attachment: %v", err)
 				continue
 			}
 
-			parsedMsg.Attachments = append(parsedMsg.Attachments, &Attachment{
-				Filename:    filename,
-				ContentType: contentType,
-				Data:        data,
-			})
+			parsedMsg.Attachments = append(parsedMsg.Attachments, attachment)
 		}
 	}
 
-	// 如果正文为空，尝试从邮件实体中提取
+	// 如果正文为空，使用已读入内存的文本附件
 	if parsedMsg.TextBody == "" && parsedMsg.HTMLBody == "" {
-		textBody, htmlBody, _ := extractBodyFromEntity(entity)
-		parsedMsg.TextBody = textBody
-		parsedMsg.HTMLBody = htmlBody
+		for _, a := range parsedMsg.Attachments {
+			if !a.InMemory() {
+				continue
+			}
+			switch {
+			case parsedMsg.TextBody == "" && strings.HasPrefix(a.ContentType, "text/plain"):
+				parsedMsg.TextBody = string(a.Data)
+			case parsedMsg.HTMLBody == "" && strings.HasPrefix(a.ContentType, "text/html"):
+				parsedMsg.HTMLBody = string(a.Data)
+			}
+		}
 	}
+	parsedMsg.Snippet = makeSnippet(parsedMsg.TextBody, parsedMsg.HTMLBody)
 
-	return parsedMsg, nil
+	return nil
 }
 
 // extractBodyFromEntity 从邮件实体中提取正文
@@ -255,6 +529,10 @@ func extractBodyFromEntity(e *message.Entity) (textBody string, htmlBody string,
 				break
 			}
 			if err != nil {
+				if p == nil {
+					// 无法继续读取后续部分，如没有任何部分的多部分邮件
+					break
+				}
 				continue
 			}
 
@@ -298,12 +576,14 @@ func extractBodyFromEntity(e *message.Entity) (textBody string, htmlBody string,
 // 参数(通过opt ...any传递):
 //   - int: [可选] 要获取的邮件数量，默认为10封
 //   - string: [可选] 邮箱名称，默认为"INBOX"(收件箱)
+//   - FetchOptions/*FetchOptions: [可选] 只获取部分正文、跳过大邮件等设置
 //
 // 用法示例:
 //   - client.GetEmail() - 获取收件箱最新的10封邮件
 //   - client.GetEmail(5) - 获取收件箱最新的5封邮件
 //   - client.GetEmail("Sent") - 获取已发送邮件箱中最新的10封邮件
 //   - client.GetEmail(3, "Drafts") - 获取草稿箱中最新的3封邮件
+//   - client.GetEmail(20, FetchOptions{PartialBytes: 4096, MaxSize: 10 << 20}) - 获取最新20封邮件正文的前4KB，不下载超过10MB的邮件
 //
 // 返回:
 //   - []*ParsedMessage: 解析后的邮件列表
@@ -311,6 +591,7 @@ func extractBodyFromEntity(e *message.Entity) (textBody string, htmlBody string,
 func (c *ImapClient) GetEmail(opt ...any) ([]*ParsedMessage, error) {
 	var n = 10
 	var mailbox = "INBOX"
+	var options = &FetchOptions{}
 	// 处理传入的参数
 	for _, v := range opt {
 		switch val := v.(type) {
@@ -318,10 +599,27 @@ func (c *ImapClient) GetEmail(opt ...any) ([]*ParsedMessage, error) {
 			n = val
 		case string:
 			mailbox = val
+		case FetchOptions:
+			options = &val
+		case *FetchOptions:
+			if val != nil {
+				options = val
+			}
 		}
 	}
+
+	var messages []*ParsedMessage
+	err := c.withConn(func() (err error) {
+		messages, err = c.getEmail(n, mailbox, options)
+		return err
+	})
+	return messages, err
+}
+
+// getEmail 获取邮箱中最近n封邮件的内容
+func (c *ImapClient) getEmail(n int, mailbox string, options *FetchOptions) ([]*ParsedMessage, error) {
 	// 选择邮箱
-	_, err := c.client.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
+	_, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
 	if err != nil {
 		return nil, err
 	}
@@ -352,27 +650,10 @@ func (c *ImapClient) GetEmail(opt ...any) ([]*ParsedMessage, error) {
 		},
 	}
 
-	// 获取邮件完整内容
-	cmd := c.client.Fetch(seqSet, &imap.FetchOptions{
-		Flags:        true,
-		InternalDate: true,
-		RFC822Size:   true,
-		Envelope:     true,
-		BodySection: []*imap.FetchItemBodySection{
-			{}, // 获取完整邮件
-		},
-	})
-
-	var messages []*ParsedMessage
-	for msg := cmd.Next(); msg != nil; msg = cmd.Next() {
-		parsedMsg, err := parseMessage(msg)
-		if err != nil {
-			return nil, err
-		}
-		messages = append(messages, parsedMsg)
+	if options.MaxSize > 0 {
+		return c.fetchLimited(seqSet, options)
 	}
-
-	return messages, nil
+	return c.fetchMessages(seqSet, options.imapOptions(), options.KeepRaw)
 }
 
 // MonitEmail 监听新邮件到来，当收到指定数量的新邮件或超时后返回
@@ -407,153 +688,77 @@ func (c *ImapClient) MonitEmail(opt ...any) ([]*ParsedMessage, error) {
 		}
 	}
 
-	// 选择邮箱
-	_, err := c.client.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
-	if err != nil {
-		return nil, err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// 获取初始邮件数量
-	status, err := c.client.Status(mailbox, &imap.StatusOptions{
-		NumMessages: true,
-	}).Wait()
+	events, err := c.Watch(ctx, mailbox)
 	if err != nil {
 		return nil, err
 	}
 
-	var initialMessages uint32 = 0
-	if status.NumMessages != nil {
-		initialMessages = *status.NumMessages
+	// 收集新邮件的UID，通道关闭时IDLE已经结束
+	var uids []imap.UID
+	var watchErr error
+	for ev := range events {
+		switch ev.Type {
+		case MailboxEventNewMessage:
+			log.Debug("检测到新邮件", ev.UID)
+			uids = append(uids, ev.UID)
+			if len(uids) >= n {
+				cancel()
+			}
+		case MailboxEventError:
+			watchErr = ev.Err
+		}
 	}
 
-	log.Debug("当前邮箱有", initialMessages, "封邮件，开始监听新邮件")
-
-	// 启动IDLE命令进行监听
-	idleCmd, err := c.client.Idle()
-	if err != nil {
-		return nil, err
+	if len(uids) == 0 {
+		if watchErr != nil {
+			return nil, watchErr
+		}
+		log.Debug("监听超时，没有收到新邮件")
+		return []*ParsedMessage{}, nil
 	}
 
-	// 设置超时
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	// 用于接收终止信号
-	stopChan := make(chan struct{})
-
-	// 用于存储新邮件
+	// 获取新邮件的完整内容，其他goroutine或重连可能已经选中了别的邮箱，需要重新选择
 	var newMessages []*ParsedMessage
-
-	// 在goroutine中检查邮箱更新
-	go func() {
-		for {
-			select {
-			case <-timer.C:
-				// 超时，关闭IDLE命令
-				idleCmd.Close()
-				return
-
-			case <-stopChan:
-				// 收到停止信号
-				return
-
-			case <-time.After(time.Second * 3):
-				// 每3秒检查一次邮箱状态
-				currentStatus, err := c.client.Status(mailbox, &imap.StatusOptions{
-					NumMessages: true,
-				}).Wait()
-				if err != nil {
-					continue
-				}
-
-				if currentStatus.NumMessages == nil {
-					continue
-				}
-
-				currentMessages := *currentStatus.NumMessages
-				if currentMessages > initialMessages {
-					// 有新邮件到达
-					newCount := currentMessages - initialMessages
-					log.Debug("检测到", newCount, "封新邮件")
-
-					// 暂时中断IDLE
-					idleCmd.Close()
-
-					// 获取新邮件
-					seqSet := imap.SeqSet{}
-					for i := initialMessages + 1; i <= currentMessages; i++ {
-						seqSet.AddNum(i)
-					}
-
-					// 获取新邮件的完整内容
-					fetchCmd := c.client.Fetch(seqSet, &imap.FetchOptions{
-						Flags:        true,
-						InternalDate: true,
-						RFC822Size:   true,
-						Envelope:     true,
-						BodySection: []*imap.FetchItemBodySection{
-							{}, // 获取完整邮件
-						},
-					})
-
-					// 解析新邮件
-					for msg := fetchCmd.Next(); msg != nil; msg = fetchCmd.Next() {
-						parsedMsg, err := parseMessage(msg)
-						if err != nil {
-							continue
-						}
-						newMessages = append(newMessages, parsedMsg)
-					}
-
-					if err := fetchCmd.Close(); err != nil {
-						log.Debug("获取邮件时出错:", err)
-					}
-
-					// 更新初始计数
-					initialMessages = currentMessages
-
-					// 如果达到所需数量，就停止监听
-					if len(newMessages) >= n {
-						close(stopChan)
-						return
-					}
-
-					// 重新开始IDLE
-					idleCmd, err = c.client.Idle()
-					if err != nil {
-						close(stopChan)
-						return
-					}
-				}
-			}
-		}
-	}()
-
-	// 等待监听结束
-	select {
-	case <-stopChan:
-		// 收到停止信号
-		if idleCmd != nil {
-			idleCmd.Close()
+	err = c.withConn(func() error {
+		newMessages = nil
+		if _, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+			return err
 		}
-
-	case <-timer.C:
-		// 超时
-		if idleCmd != nil {
-			idleCmd.Close()
+		cmd := c.client.Fetch(imap.UIDSetNum(uids...), &imap.FetchOptions{
+			Flags:        true,
+			InternalDate: true,
+			RFC822Size:   true,
+			Envelope:     true,
+			UID:          true,
+			BodySection: []*imap.FetchItemBodySection{
+				{}, // 获取完整邮件
+			},
+		})
+		defer cmd.Close()
+
+		for msg := cmd.Next(); msg != nil; msg = cmd.Next() {
+			parsedMsg, err := c.parseMessage(msg, false)
+			if err != nil {
+				log.Debug("解析邮件时出错:", err)
+				continue
+			}
+			newMessages = append(newMessages, parsedMsg)
 		}
-		log.Debug("监听超时，收到", len(newMessages), "封新邮件")
-	}
-
-	// 等待IDLE命令完成
-	if idleCmd != nil {
-		idleCmd.Wait()
+		return cmd.Close()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return newMessages, nil
 }
 
 // GetMailboxStatus 获取邮箱状态信息
+// 使用STATUS命令获取，不会改变当前选中的邮箱
+// 邮箱恰好是当前选中的邮箱时，会额外填充PermanentFlags和RecentMessages
 // 参数:
 //   - mailbox: 邮箱名称，默认为"INBOX"
 //
@@ -561,51 +766,179 @@ func (c *ImapClient) MonitEmail(opt ...any) ([]*ParsedMessage, error) {
 //   - *MailboxStatus: 邮箱状态信息
 //   - error: 获取过程中的错误
 func (c *ImapClient) GetMailboxStatus(mailbox string) (*MailboxStatus, error) {
+	var status *MailboxStatus
+	err := c.withConn(func() (err error) {
+		status, err = c.getMailboxStatus(mailbox)
+		return err
+	})
+	return status, err
+}
+
+// getMailboxStatus GetMailboxStatus的实现
+func (c *ImapClient) getMailboxStatus(mailbox string) (*MailboxStatus, error) {
 	if mailbox == "" {
 		mailbox = "INBOX"
 	}
 
-	// 选择邮箱
-	_, err := c.client.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
+	// 获取邮箱状态
+	status, err := c.client.Status(mailbox, c.statusOptions()).Wait()
 	if err != nil {
 		return nil, err
 	}
 
-	// 获取邮箱状态
-	status, err := c.client.Status(mailbox, &imap.StatusOptions{
-		NumMessages: true,
-		UIDNext:     true,
-		UIDValidity: true,
-	}).Wait()
+	result := newMailboxStatus(status)
+	result.Name = mailbox
+
+	// 只有已选中的邮箱才能获取永久标志和\Recent计数
+	if selected := c.client.Mailbox(); selected != nil && selected.Name == mailbox {
+		result.PermanentFlags = selected.PermanentFlags
+		recent, err := c.countRecent()
+		if err != nil {
+			return nil, err
+		}
+		result.RecentMessages = recent
+	}
+
+	return result, nil
+}
+
+// GetAllMailboxStatus 获取所有可选择邮箱的状态信息
+// 服务器支持LIST-STATUS时在一次LIST中完成，否则逐个邮箱发送STATUS
+// 返回:
+//   - []*MailboxStatus: 邮箱状态列表，顺序与LIST返回的顺序一致
+//   - error: 获取过程中的错误
+func (c *ImapClient) GetAllMailboxStatus() ([]*MailboxStatus, error) {
+	var result []*MailboxStatus
+	err := c.withConn(func() (err error) {
+		result, err = c.getAllMailboxStatus()
+		return err
+	})
+	return result, err
+}
+
+// getAllMailboxStatus GetAllMailboxStatus的实现
+func (c *ImapClient) getAllMailboxStatus() ([]*MailboxStatus, error) {
+	caps := c.client.Caps()
+	if caps.Has(imap.CapListStatus) || caps.Has(imap.CapIMAP4rev2) {
+		mailboxes, err := c.client.List("", "*", &imap.ListOptions{
+			ReturnStatus: c.statusOptions(),
+		}).Collect()
+		if err != nil {
+			return nil, err
+		}
+
+		var result []*MailboxStatus
+		for _, m := range mailboxes {
+			if m.Status == nil {
+				// 不可选择的邮箱不会返回状态
+				continue
+			}
+			status := newMailboxStatus(m.Status)
+			status.Name = m.Mailbox
+			result = append(result, status)
+		}
+		return result, nil
+	}
+
+	infos, err := c.listMailboxInfo()
 	if err != nil {
 		return nil, err
 	}
 
+	var result []*MailboxStatus
+	for _, info := range infos {
+		if !info.Selectable() {
+			continue
+		}
+		status, err := c.client.Status(info.Name, c.statusOptions()).Wait()
+		if err != nil {
+			return nil, fmt.Errorf("status %s: %w", info.Name, err)
+		}
+		s := newMailboxStatus(status)
+		s.Name = info.Name
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// statusOptions 根据服务器能力构建STATUS选项
+func (c *ImapClient) statusOptions() *imap.StatusOptions {
+	caps := c.client.Caps()
+	return &imap.StatusOptions{
+		NumMessages:   true,
+		UIDNext:       true,
+		UIDValidity:   true,
+		NumUnseen:     true,
+		Size:          caps.Has(imap.CapStatusSize) || caps.Has(imap.CapIMAP4rev2),
+		HighestModSeq: caps.Has(imap.CapCondStore),
+	}
+}
+
+// countRecent 统计当前选中邮箱中带\Recent标志的邮件数量
+// 底层库会忽略STATUS/SELECT中的RECENT响应，因此通过UID SEARCH统计；
+// IMAP4rev2已经取消了\Recent标志，只支持IMAP4rev2的服务器直接返回0
+func (c *ImapClient) countRecent() (int, error) {
+	caps := c.client.Caps()
+	if !caps.Has(imap.CapIMAP4rev1) && caps.Has(imap.CapIMAP4rev2) {
+		return 0, nil
+	}
+	selected := c.client.Mailbox()
+	if selected == nil || selected.NumMessages == 0 {
+		return 0, nil
+	}
+
+	// 支持ESEARCH时只返回数量
+	var options *imap.SearchOptions
+	if caps.Has(imap.CapESearch) {
+		options = &imap.SearchOptions{ReturnCount: true}
+	}
+	data, err := c.client.UIDSearch(&imap.SearchCriteria{
+		Flag: []imap.Flag{"\\Recent"},
+	}, options).Wait()
+	if err != nil {
+		return 0, err
+	}
+	if options != nil {
+		return int(data.Count), nil
+	}
+	return len(data.AllUIDs()), nil
+}
+
+// newMailboxStatus 将STATUS响应转换为MailboxStatus
+func newMailboxStatus(status *imap.StatusData) *MailboxStatus {
 	result := &MailboxStatus{
-		Name: mailbox,
+		Name:          status.Mailbox,
+		UIDNext:       status.UIDNext,
+		UIDValidity:   status.UIDValidity,
+		HighestModSeq: status.HighestModSeq,
 	}
 
 	if status.NumMessages != nil {
 		result.TotalMessages = int(*status.NumMessages)
 	}
 
-	if status.UIDNext != 0 {
-		result.UIDNext = status.UIDNext
+	if status.NumUnseen != nil {
+		result.UnseenMessages = int(*status.NumUnseen)
 	}
 
-	if status.UIDValidity != 0 {
-		result.UIDValidity = status.UIDValidity
+	if status.Size != nil {
+		result.Size = *status.Size
 	}
 
-	return result, nil
+	return result
 }
 
 // MailboxStatus 邮箱状态信息
 type MailboxStatus struct {
-	Name          string   // 邮箱名称
-	TotalMessages int      // 邮件总数
-	UIDNext       imap.UID // 下一个 UID
-	UIDValidity   uint32   // UID 有效性
+	Name           string      // 邮箱名称
+	TotalMessages  int         // 邮件总数
+	UnseenMessages int         // 未读邮件数
+	RecentMessages int         // 带\Recent标志的邮件数，仅邮箱已被选中时有效
+	Size           int64       // 邮箱总大小（字节），需要服务器支持STATUS=SIZE
+	UIDNext        imap.UID    // 下一个 UID
+	UIDValidity    uint32      // UID 有效性
+	HighestModSeq  uint64      // 最高修改序列号，需要服务器支持CONDSTORE
+	PermanentFlags []imap.Flag // 可永久保存的标志，仅邮箱已被选中时有效
 }
 
 // MarkAsRead 标记邮件为已读
@@ -616,12 +949,19 @@ type MailboxStatus struct {
 // 返回:
 //   - error: 标记过程中的错误
 func (c *ImapClient) MarkAsRead(messageID, mailbox string) error {
+	return c.withConn(func() error {
+		return c.markAsRead(messageID, mailbox)
+	})
+}
+
+// markAsRead MarkAsRead的实现
+func (c *ImapClient) markAsRead(messageID, mailbox string) error {
 	if mailbox == "" {
 		mailbox = "INBOX"
 	}
 
 	// 选择邮箱
-	_, err := c.client.Select(mailbox, nil).Wait()
+	_, err := c.selectMailbox(mailbox, nil)
 	if err != nil {
 		return err
 	}
@@ -646,12 +986,22 @@ func (c *ImapClient) MarkAsRead(messageID, mailbox string) error {
 //   - []*ParsedMessage: 解析后的邮件列表
 //   - error: 获取过程中的错误
 func (c *ImapClient) GetEmailByRange(start, end int, mailbox string) ([]*ParsedMessage, error) {
+	var messages []*ParsedMessage
+	err := c.withConn(func() (err error) {
+		messages, err = c.getEmailByRange(start, end, mailbox)
+		return err
+	})
+	return messages, err
+}
+
+// getEmailByRange GetEmailByRange的实现
+func (c *ImapClient) getEmailByRange(start, end int, mailbox string) ([]*ParsedMessage, error) {
 	if mailbox == "" {
 		mailbox = "INBOX"
 	}
 
 	// 选择邮箱
-	_, err := c.client.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
+	_, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
 	if err != nil {
 		return nil, err
 	}
@@ -668,19 +1018,25 @@ func (c *ImapClient) GetEmailByRange(start, end int, mailbox string) ([]*ParsedM
 		InternalDate: true,
 		RFC822Size:   true,
 		Envelope:     true,
+		UID:          true,
 		BodySection: []*imap.FetchItemBodySection{
 			{}, // 获取完整邮件
 		},
 	})
 
+	defer cmd.Close()
+
 	var messages []*ParsedMessage
 	for msg := cmd.Next(); msg != nil; msg = cmd.Next() {
-		parsedMsg, err := parseMessage(msg)
+		parsedMsg, err := c.parseMessage(msg, false)
 		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, parsedMsg)
 	}
+	if err := cmd.Close(); err != nil {
+		return nil, err
+	}
 
 	return messages, nil
 }
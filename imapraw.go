@@ -0,0 +1,652 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/go-enols/go-log"
+)
+
+// rawIMAP 直接收发IMAP命令的简单连接
+// 底层库无法解析非标准的响应数据（如Gmail的X-GM-LABELS），遇到时会断开连接，
+// 因此这类命令通过单独的连接发送。只支持顺序执行命令，调用方负责加锁
+type rawIMAP struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	tag      int
+	mailbox  string // 当前选中的邮箱
+	readOnly bool
+	preauth  bool // 服务器在问候中表示已经认证
+
+	qresyncEnabled bool // 是否已经启用QRESYNC
+}
+
+// rawAtom 响应中的原子，如FETCH、NIL、\Seen
+type rawAtom string
+
+// rawList 响应中带括号的列表，元素为rawAtom、string或rawList
+type rawList []any
+
+// rawLiteral 命令中以字面量(literal)发送的参数
+type rawLiteral []byte
+
+// rawStream 命令中以字面量发送的参数，内容从R中读取Size字节，不必预先读入内存
+type rawStream struct {
+	R    io.Reader
+	Size int64
+}
+
+// rawResponse 一条未标记(untagged)的响应，不包括开头的"*"
+type rawResponse rawList
+
+// rawStatusError 服务器以NO或BAD完成命令，连接本身仍然可用
+type rawStatusError struct {
+	Status string
+	Text   string
+}
+
+func (e *rawStatusError) Error() string {
+	return fmt.Sprintf("imap: %s %s", e.Status, e.Text)
+}
+
+// dialRawIMAP 建立连接并登录
+func dialRawIMAP(data *LoginParams) (*rawIMAP, error) {
+	conn, err := dialConn(data)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newRawIMAP(conn, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.login(data); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// withRaw 使用辅助连接执行命令，连接断开导致失败时重新建立连接并重新执行一次
+// 辅助连接在首次使用时建立，之后一直保留到客户端关闭
+func (c *ImapClient) withRaw(fn func(r *rawIMAP) error) error {
+	return c.useRaw(2, fn)
+}
+
+// withRawOnce 与withRaw相同，但失败后不重新执行，用于APPEND等不幂等的命令
+func (c *ImapClient) withRawOnce(fn func(r *rawIMAP) error) error {
+	return c.useRaw(1, fn)
+}
+
+// useRaw withRaw和withRawOnce的实现，attempts为最多执行的次数
+func (c *ImapClient) useRaw(attempts int, fn func(r *rawIMAP) error) error {
+	c.rawMu.Lock()
+	defer c.rawMu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if c.closed.Load() {
+			return net.ErrClosed
+		}
+		if c.raw == nil {
+			if c.raw, err = dialRawIMAP(c.login); err != nil {
+				c.raw = nil
+				return fmt.Errorf("raw imap connection: %w", err)
+			}
+		}
+
+		err = fn(c.raw)
+		var statusErr *rawStatusError
+		if err == nil || errors.As(err, &statusErr) {
+			return err
+		}
+
+		log.Debugf("raw imap connection to %s lost: %v", c.login.Host, err)
+		c.raw.conn.Close()
+		c.raw = nil
+	}
+	return err
+}
+
+// closeRaw 关闭辅助连接
+func (c *ImapClient) closeRaw() {
+	c.rawMu.Lock()
+	defer c.rawMu.Unlock()
+
+	if c.raw != nil {
+		c.raw.Close()
+		c.raw = nil
+	}
+}
+
+// newRawIMAP 在已建立的连接上读取问候，需要时通过STARTTLS升级为TLS
+// 出错时会关闭连接
+func newRawIMAP(conn net.Conn, data *LoginParams) (*rawIMAP, error) {
+	c := &rawIMAP{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	fields := strings.Fields(string(greeting))
+	if len(fields) < 2 || fields[0] != "*" || strings.EqualFold(fields[1], "BYE") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting)
+	}
+	c.preauth = strings.EqualFold(fields[1], "PREAUTH")
+
+	if data.tlsMode() == TLSStartTLS {
+		if c.preauth {
+			conn.Close()
+			return nil, fmt.Errorf("imap: server sent PREAUTH on unencrypted connection")
+		}
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn = tls.Client(conn, data.tlsConfig())
+		c.r = bufio.NewReader(c.conn)
+	}
+	return c, nil
+}
+
+// login 登录，需要OAuth2的账号使用XOAUTH2认证
+func (c *rawIMAP) login(data *LoginParams) error {
+	if c.preauth {
+		return nil
+	}
+	auth, err := data.oauth2Authenticator()
+	if err != nil {
+		return err
+	}
+	if auth != nil {
+		return c.authenticate(auth)
+	}
+	_, err = c.command("LOGIN", astringIMAP(data.User), astringIMAP(data.Pwd))
+	return err
+}
+
+// saslClient SASL认证机制，与go-sasl的sasl.Client相同
+type saslClient interface {
+	Start() (mech string, ir []byte, err error)
+	Next(challenge []byte) (response []byte, err error)
+}
+
+// authenticate 使用SASL机制认证(AUTHENTICATE)
+// 初始响应在收到第一个继续请求后发送，因此不要求服务器支持SASL-IR
+func (c *rawIMAP) authenticate(auth saslClient) error {
+	mech, ir, err := auth.Start()
+	if err != nil {
+		return err
+	}
+
+	c.tag++
+	tag := "R" + strconv.Itoa(c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s AUTHENTICATE %s\r\n", tag, mech); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(line) > 0 && line[0] == '+':
+			var resp []byte
+			if ir != nil {
+				resp, ir = ir, nil
+			} else {
+				challenge, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(string(line[1:])))
+				if resp, err = auth.Next(challenge); err != nil {
+					// 取消认证，服务器随后以NO或BAD结束命令
+					if _, err := io.WriteString(c.conn, "*\r\n"); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if _, err := io.WriteString(c.conn, base64.StdEncoding.EncodeToString(resp)+"\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(string(line), tag+" "):
+			fields := strings.SplitN(string(line), " ", 3)
+			if len(fields) >= 2 && strings.EqualFold(fields[1], "OK") {
+				return nil
+			}
+			status := &rawStatusError{Status: fields[1]}
+			if len(fields) == 3 {
+				status.Text = fields[2]
+			}
+			return status
+		}
+	}
+}
+
+// capabilities 查询服务器当前的能力
+func (c *rawIMAP) capabilities() ([]string, error) {
+	responses, err := c.command("CAPABILITY")
+	if err != nil {
+		return nil, err
+	}
+	var caps []string
+	for _, resp := range responses {
+		if len(resp) == 0 || !strings.EqualFold(atomString(resp[0]), "CAPABILITY") {
+			continue
+		}
+		for _, item := range resp[1:] {
+			caps = append(caps, atomString(item))
+		}
+	}
+	return caps, nil
+}
+
+// Close 退出登录并关闭连接
+func (c *rawIMAP) Close() error {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.command("LOGOUT")
+	return c.conn.Close()
+}
+
+// selectMailbox 选择邮箱，已选中时不再发送
+func (c *rawIMAP) selectMailbox(mailbox string, readOnly bool) error {
+	if c.mailbox == mailbox && c.readOnly == readOnly {
+		return nil
+	}
+	cmd := "SELECT"
+	if readOnly {
+		cmd = "EXAMINE"
+	}
+	if _, err := c.command(cmd, quoteIMAP(encodeMailboxName(mailbox))); err != nil {
+		c.mailbox = ""
+		return err
+	}
+	c.mailbox = mailbox
+	c.readOnly = readOnly
+	return nil
+}
+
+// command 发送命令并等待完成，返回期间收到的全部未标记响应
+// 参数中的string原样发送（用空格连接），rawLiteral和*rawStream以字面量发送
+func (c *rawIMAP) command(args ...any) ([]rawResponse, error) {
+	responses, _, err := c.run(args...)
+	return responses, err
+}
+
+// run 与command相同，另外返回完成响应中OK之后的文本，如"[APPENDUID 38505 3955] APPEND completed"
+func (c *rawIMAP) run(args ...any) ([]rawResponse, string, error) {
+	c.tag++
+	tag := "R" + strconv.Itoa(c.tag)
+
+	var line bytes.Buffer
+	line.WriteString(tag)
+	for _, arg := range args {
+		line.WriteByte(' ')
+		switch v := arg.(type) {
+		case string:
+			line.WriteString(v)
+		case rawLiteral:
+			if err := c.writeLiteral(&line, int64(len(v))); err != nil {
+				return nil, "", err
+			}
+			line.Write(v)
+		case *rawStream:
+			if err := c.writeLiteral(&line, v.Size); err != nil {
+				return nil, "", err
+			}
+			if _, err := io.CopyN(c.conn, v.R, v.Size); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	line.WriteString("\r\n")
+	if _, err := c.conn.Write(line.Bytes()); err != nil {
+		return nil, "", err
+	}
+
+	var responses []rawResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(resp) < 2 {
+			continue
+		}
+		first, _ := resp[0].(rawAtom)
+		switch {
+		case first == "*":
+			responses = append(responses, rawResponse(resp[1:]))
+		case string(first) == tag:
+			status, _ := resp[1].(rawAtom)
+			if strings.EqualFold(string(status), "OK") {
+				return responses, joinAtoms(resp[2:]), nil
+			}
+			return nil, "", &rawStatusError{Status: string(status), Text: joinAtoms(resp[2:])}
+		}
+	}
+}
+
+// writeLiteral 发送line中已有的内容和字面量的长度，并等待服务器的继续请求
+// 返回后line为空，调用方随后发送字面量的内容
+func (c *rawIMAP) writeLiteral(line *bytes.Buffer, size int64) error {
+	fmt.Fprintf(line, "{%d}\r\n", size)
+	if _, err := c.conn.Write(line.Bytes()); err != nil {
+		return err
+	}
+	line.Reset()
+	return c.waitContinuation()
+}
+
+// waitContinuation 等待服务器的继续请求("+")
+func (c *rawIMAP) waitContinuation() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(string(line), "+") {
+			return nil
+		}
+		if fields := strings.Fields(string(line)); len(fields) > 1 && fields[0] != "*" {
+			return fmt.Errorf("imap: %s", line)
+		}
+	}
+}
+
+// readResponse 读取一条完整的响应，字面量会被读入并作为字符串返回
+func (c *rawIMAP) readResponse() (rawList, error) {
+	var logical []byte
+	var literals [][]byte
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		logical = append(logical, line...)
+
+		// 行尾为{n}表示后面跟着n字节的字面量
+		n, ok := literalSize(line)
+		if !ok {
+			break
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return nil, err
+		}
+		literals = append(literals, lit)
+	}
+
+	resp, err := parseRawLine(logical, literals)
+	if err != nil {
+		// 状态响应中的文本可能包含不成对的括号，按空格拆分即可
+		for _, field := range strings.Fields(string(logical)) {
+			resp = append(resp, rawAtom(field))
+		}
+	}
+	return resp, nil
+}
+
+// readLine 读取一行，不包括行尾的CRLF
+func (c *rawIMAP) readLine() ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// literalSize 解析行尾的字面量长度
+func literalSize(line []byte) (int, bool) {
+	if len(line) < 3 || line[len(line)-1] != '}' {
+		return 0, false
+	}
+	start := bytes.LastIndexByte(line, '{')
+	if start < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(string(line[start+1:len(line)-1]), "+"))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseRawLine 将一行响应解析为原子、字符串和列表
+// 行中的"{n}"依次由literals中的内容替换
+func parseRawLine(line []byte, literals [][]byte) (rawList, error) {
+	p := &rawParser{line: line, literals: literals}
+	var items rawList
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.line) {
+			return items, nil
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+type rawParser struct {
+	line     []byte
+	pos      int
+	literals [][]byte
+}
+
+func (p *rawParser) skipSpace() {
+	for p.pos < len(p.line) && p.line[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *rawParser) parseItem() (any, error) {
+	switch p.line[p.pos] {
+	case '(':
+		p.pos++
+		var list rawList
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.line) {
+				return nil, fmt.Errorf("imap: unterminated list")
+			}
+			if p.line[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			item, err := p.parseItem()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case '"':
+		p.pos++
+		var sb strings.Builder
+		for p.pos < len(p.line) {
+			ch := p.line[p.pos]
+			p.pos++
+			switch ch {
+			case '\\':
+				if p.pos < len(p.line) {
+					sb.WriteByte(p.line[p.pos])
+					p.pos++
+				}
+			case '"':
+				return sb.String(), nil
+			default:
+				sb.WriteByte(ch)
+			}
+		}
+		return nil, fmt.Errorf("imap: unterminated string")
+	case '{':
+		end := bytes.IndexByte(p.line[p.pos:], '}')
+		if end < 0 || len(p.literals) == 0 {
+			return nil, fmt.Errorf("imap: invalid literal")
+		}
+		p.pos += end + 1
+		lit := p.literals[0]
+		p.literals = p.literals[1:]
+		return string(lit), nil
+	default:
+		start := p.pos
+		depth := 0 // 原子中可能包含"BODY[HEADER]"这样的方括号
+		for p.pos < len(p.line) {
+			ch := p.line[p.pos]
+			if depth <= 0 && (ch == ' ' || ch == '(' || ch == ')') {
+				break
+			}
+			switch ch {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+			p.pos++
+		}
+		if p.pos == start { // 不匹配的右括号
+			p.pos++
+		}
+		return rawAtom(p.line[start:p.pos]), nil
+	}
+}
+
+// parseUIDSet 解析UID集合，如"1:3,5,7:9"
+func parseUIDSet(s string) (imap.UIDSet, error) {
+	var uids imap.UIDSet
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, ":")
+		start, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UID set %q", s)
+		}
+		stop := start
+		if isRange {
+			if stop, err = strconv.ParseUint(last, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid UID set %q", s)
+			}
+		}
+		uids.AddRange(imap.UID(min(start, stop)), imap.UID(max(start, stop)))
+	}
+	return uids, nil
+}
+
+// joinAtoms 将响应中的文本部分重新拼接，用于错误信息
+func joinAtoms(items rawList) string {
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case rawAtom:
+			parts = append(parts, string(v))
+		case string:
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// astringIMAP 将字符串编码为命令参数，包含非ASCII字符时使用字面量
+func astringIMAP(s string) any {
+	if isASCII(s) {
+		return quoteIMAP(s)
+	}
+	return rawLiteral(s)
+}
+
+// quoteIMAP 将字符串编码为IMAP带引号的字符串
+func quoteIMAP(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// modifiedBase64 修改版UTF-7使用的Base64编码(RFC 3501 5.1.3)，以","代替"/"且不填充
+var modifiedBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// encodeMailboxName 将邮箱名称或标签编码为修改版UTF-7
+func encodeMailboxName(name string) string {
+	var sb strings.Builder
+	var pending []rune
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		buf := make([]byte, len(units)*2)
+		for i, u := range units {
+			buf[i*2] = byte(u >> 8)
+			buf[i*2+1] = byte(u)
+		}
+		sb.WriteByte('&')
+		sb.WriteString(modifiedBase64.EncodeToString(buf))
+		sb.WriteByte('-')
+		pending = nil
+	}
+
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				sb.WriteString("&-")
+			} else {
+				sb.WriteRune(r)
+			}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	flush()
+	return sb.String()
+}
+
+// decodeMailboxName 解码修改版UTF-7编码的邮箱名称或标签，格式错误时原样返回
+func decodeMailboxName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '&' {
+			sb.WriteByte(name[i])
+			continue
+		}
+		end := strings.IndexByte(name[i:], '-')
+		if end < 0 {
+			return name
+		}
+		encoded := name[i+1 : i+end]
+		i += end
+		if encoded == "" {
+			sb.WriteByte('&')
+			continue
+		}
+		buf, err := modifiedBase64.DecodeString(encoded)
+		if err != nil || len(buf)%2 != 0 {
+			return name
+		}
+		units := make([]uint16, len(buf)/2)
+		for j := range units {
+			units[j] = uint16(buf[j*2])<<8 | uint16(buf[j*2+1])
+		}
+		sb.WriteString(string(utf16.Decode(units)))
+	}
+	return sb.String()
+}
@@ -0,0 +1,191 @@
+package email
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// pipeRawIMAP 返回连接到内存管道的rawIMAP，server在另一端模拟服务器
+func pipeRawIMAP(t *testing.T, server func(r *bufio.Reader, w net.Conn)) *rawIMAP {
+	t.Helper()
+
+	client, conn := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	go func() {
+		defer conn.Close()
+		server(bufio.NewReader(conn), conn)
+	}()
+	return &rawIMAP{conn: client, r: bufio.NewReader(client)}
+}
+
+func TestLiteralSize(t *testing.T) {
+	tests := []struct {
+		line string
+		n    int
+		ok   bool
+	}{
+		{"* 1 FETCH (BODY[] {42}", 42, true},
+		{"A1 APPEND INBOX {5+}", 5, true},
+		{"* OK done", 0, false},
+		{"* 1 FETCH (X {abc}", 0, false},
+		{"}", 0, false},
+		{"{}", 0, false},
+	}
+	for _, tt := range tests {
+		n, ok := literalSize([]byte(tt.line))
+		if n != tt.n || ok != tt.ok {
+			t.Errorf("literalSize(%q) = %d, %v, want %d, %v", tt.line, n, ok, tt.n, tt.ok)
+		}
+	}
+}
+
+func TestParseRawLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		literals []string
+		want     rawList
+	}{
+		{
+			line: `* 1 FETCH (UID 7 FLAGS (\Seen $Junk))`,
+			want: rawList{rawAtom("*"), rawAtom("1"), rawAtom("FETCH"), rawList{
+				rawAtom("UID"), rawAtom("7"), rawAtom("FLAGS"), rawList{rawAtom(`\Seen`), rawAtom("$Junk")},
+			}},
+		},
+		{
+			line: `* LIST () "/" "a \"b\" \\c"`,
+			want: rawList{rawAtom("*"), rawAtom("LIST"), rawList(nil), "/", `a "b" \c`},
+		},
+		{
+			line:     `* 2 FETCH (BODY[HEADER.FIELDS (SUBJECT)] {9} UID 3)`,
+			literals: []string{"Subject:x"},
+			want: rawList{rawAtom("*"), rawAtom("2"), rawAtom("FETCH"), rawList{
+				rawAtom("BODY[HEADER.FIELDS (SUBJECT)]"), "Subject:x", rawAtom("UID"), rawAtom("3"),
+			}},
+		},
+		{
+			line: `* 1 FETCH (X-GM-LABELS ("\\Inbox" foo) X-GM-MSGID 123)`,
+			want: rawList{rawAtom("*"), rawAtom("1"), rawAtom("FETCH"), rawList{
+				rawAtom("X-GM-LABELS"), rawList{`\Inbox`, rawAtom("foo")}, rawAtom("X-GM-MSGID"), rawAtom("123"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		var literals [][]byte
+		for _, lit := range tt.literals {
+			literals = append(literals, []byte(lit))
+		}
+		got, err := parseRawLine([]byte(tt.line), literals)
+		if err != nil {
+			t.Errorf("parseRawLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRawLine(%q) = %#v, want %#v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseRawLineErrors(t *testing.T) {
+	for _, line := range []string{
+		`* 1 FETCH (UID 7`,
+		`* OK "unterminated`,
+		`* 1 FETCH (BODY[] {3})`, // 缺少字面量的内容
+	} {
+		if _, err := parseRawLine([]byte(line), nil); err == nil {
+			t.Errorf("parseRawLine(%q): expected error", line)
+		}
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	c := pipeRawIMAP(t, func(r *bufio.Reader, w net.Conn) {
+		w.Write([]byte("* 1 FETCH (UID 5 BODY[] {12}\r\nline1\r\nline2 X-GM-THRID 9)\r\n"))
+		w.Write([]byte("R1 OK [ALERT] text (with unbalanced paren\r\n"))
+	})
+
+	resp, err := c.readResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rawList{rawAtom("*"), rawAtom("1"), rawAtom("FETCH"), rawList{
+		rawAtom("UID"), rawAtom("5"), rawAtom("BODY[]"), "line1\r\nline2", rawAtom("X-GM-THRID"), rawAtom("9"),
+	}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Fatalf("got %#v, want %#v", resp, want)
+	}
+
+	// 无法解析的状态响应按空格拆分
+	resp, err = c.readResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) < 3 || resp[0] != rawAtom("R1") || resp[1] != rawAtom("OK") {
+		t.Fatalf("got %#v", resp)
+	}
+}
+
+func TestParseUIDSet(t *testing.T) {
+	uids, err := parseUIDSet("1:3,9,7:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := uids.Nums()
+	want := []imap.UID{1, 2, 3, 5, 6, 7, 9}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := parseUIDSet("1:x"); err == nil {
+		t.Error("expected error for invalid set")
+	}
+}
+
+func TestGmailInfo(t *testing.T) {
+	commands := make(chan string, 2)
+	c := pipeRawIMAP(t, func(r *bufio.Reader, w net.Conn) {
+		for _, reply := range []string{
+			"* 3 EXISTS\r\nR1 OK [READ-ONLY] EXAMINE completed\r\n",
+			"* 1 FETCH (X-GM-THRID 11 X-GM-MSGID 22 X-GM-LABELS (\"\\\\Important\" \"&Ti1lh2gHe34-\") UID 4)\r\n" +
+				"* 2 FETCH (UID 6 X-GM-MSGID 33 X-GM-THRID 11 X-GM-LABELS ())\r\n" +
+				"R2 OK FETCH completed\r\n",
+		} {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			commands <- strings.TrimRight(line, "\r\n")
+			w.Write([]byte(reply))
+		}
+	})
+
+	infos := make(map[imap.UID]*GmailInfo)
+	if err := c.gmailInfo("INBOX", []imap.UID{4, 6}, infos); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-commands; got != `R1 EXAMINE "INBOX"` {
+		t.Errorf("select command = %q", got)
+	}
+	if got := <-commands; got != "R2 UID FETCH 4,6 (UID X-GM-MSGID X-GM-THRID X-GM-LABELS)" {
+		t.Errorf("fetch command = %q", got)
+	}
+
+	want := map[imap.UID]*GmailInfo{
+		4: {MsgID: 22, ThreadID: 11, Labels: []string{`\Important`, "中文标签"}},
+		6: {MsgID: 33, ThreadID: 11},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("got %d infos, want %d", len(infos), len(want))
+	}
+	for uid, info := range want {
+		if !reflect.DeepEqual(infos[uid], info) {
+			t.Errorf("UID %d: got %+v, want %+v", uid, infos[uid], info)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+)
+
+// jwzContainer JWZ算法中的容器，msg为nil表示只在References中出现过的邮件
+type jwzContainer struct {
+	id       string
+	msg      *ParsedMessage
+	parent   *jwzContainer
+	children []*jwzContainer
+}
+
+// hasDescendant c的子树中是否包含target（包括c本身）
+func (c *jwzContainer) hasDescendant(target *jwzContainer) bool {
+	if c == target {
+		return true
+	}
+	for _, child := range c.children {
+		if child.hasDescendant(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// setParent 将c移动到parent下，parent为nil时成为根节点
+func (c *jwzContainer) setParent(parent *jwzContainer) {
+	if c.parent != nil {
+		siblings := c.parent.children
+		for i, sibling := range siblings {
+			if sibling == c {
+				c.parent.children = append(siblings[:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	c.parent = parent
+	if parent != nil {
+		parent.children = append(parent.children, c)
+	}
+}
+
+// date 容器的时间，占位容器取最早的子邮件时间
+func (c *jwzContainer) date() (t int64, ok bool) {
+	if c.msg != nil {
+		return c.msg.InternalDate.UnixNano(), true
+	}
+	for _, child := range c.children {
+		if ct, cok := child.date(); cok && (!ok || ct < t) {
+			t, ok = ct, true
+		}
+	}
+	return t, ok
+}
+
+// subject 容器的主题，占位容器取第一个子邮件的主题
+func (c *jwzContainer) subject() string {
+	if c.msg != nil {
+		return c.msg.Subject
+	}
+	for _, child := range c.children {
+		if s := child.subject(); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// BuildThreads 使用JWZ算法(https://www.jwz.org/doc/threading.html)在客户端将邮件归并为会话
+// 根据Message-ID、In-Reply-To和References建立父子关系，
+// 再将主题相同（忽略回复前缀）的根会话合并。适用于不支持THREAD扩展的服务器和POP3。
+// 会话和同级邮件都按时间从早到晚排列
+// 参数:
+//   - messages: 要归并的邮件
+//
+// 返回:
+//   - []*Thread: 会话列表
+func BuildThreads(messages []*ParsedMessage) []*Thread {
+	table := make(map[string]*jwzContainer)
+	get := func(id string) *jwzContainer {
+		c, ok := table[id]
+		if !ok {
+			c = &jwzContainer{id: id}
+			table[id] = c
+		}
+		return c
+	}
+
+	// 第一步：建立父子关系
+	for i, msg := range messages {
+		id := normalizeMessageID(msg.MessageID)
+		if id == "" || (table[id] != nil && table[id].msg != nil) {
+			// 缺少或重复的邮件ID，使用唯一的内部ID
+			id = fmt.Sprintf("\x00%d", i)
+		}
+		container := get(id)
+		container.msg = msg
+
+		refs := make([]string, 0, len(msg.References)+1)
+		for _, ref := range msg.References {
+			if ref = normalizeMessageID(ref); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == 0 && len(msg.InReplyTo) > 0 {
+			if ref := normalizeMessageID(msg.InReplyTo[0]); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+
+		// 按References的顺序依次链接，已有父节点的不再改变
+		var prev *jwzContainer
+		for _, ref := range refs {
+			c := get(ref)
+			if prev != nil && c.parent == nil && c != prev && !c.hasDescendant(prev) {
+				c.setParent(prev)
+			}
+			prev = c
+		}
+
+		// 邮件自身的父节点以其References中的最后一项为准
+		if prev != nil && (prev == container || container.hasDescendant(prev)) {
+			prev = nil
+		}
+		if container.parent != prev {
+			container.setParent(prev)
+		}
+	}
+
+	// 第二步：找出根节点
+	var roots []*jwzContainer
+	for _, c := range table {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	sortContainers(roots)
+
+	// 第三步：去除空的占位容器
+	roots = pruneContainers(roots, true)
+
+	// 第四步：按主题合并根会话
+	roots = groupBySubject(roots)
+	sortContainers(roots)
+
+	threads := make([]*Thread, 0, len(roots))
+	for _, c := range roots {
+		threads = append(threads, containerThread(c))
+	}
+	return threads
+}
+
+// pruneContainers 去除没有邮件的容器：没有子节点的直接删除，
+// 有子节点的由子节点取代（根节点有多个子节点时保留，以免把无关的会话合并到一起）
+func pruneContainers(containers []*jwzContainer, root bool) []*jwzContainer {
+	var out []*jwzContainer
+	for _, c := range containers {
+		c.children = pruneContainers(c.children, false)
+		for _, child := range c.children {
+			child.parent = c
+		}
+
+		if c.msg != nil {
+			out = append(out, c)
+			continue
+		}
+		switch {
+		case len(c.children) == 0:
+			// 删除
+		case root && len(c.children) > 1:
+			out = append(out, c)
+		default:
+			for _, child := range c.children {
+				child.parent = c.parent
+			}
+			out = append(out, c.children...)
+		}
+	}
+	return out
+}
+
+// groupBySubject 将主题相同的根会话合并
+func groupBySubject(roots []*jwzContainer) []*jwzContainer {
+	subjects := make(map[string]*jwzContainer)
+	var out []*jwzContainer
+	for _, c := range roots {
+		subject := c.subject()
+		base := BaseSubject(subject)
+		if base == "" {
+			out = append(out, c)
+			continue
+		}
+
+		existing, ok := subjects[base]
+		if !ok {
+			subjects[base] = c
+			out = append(out, c)
+			continue
+		}
+
+		switch {
+		case existing.msg == nil && c.msg == nil:
+			// 两个都是占位容器：合并子节点
+			for _, child := range c.children {
+				child.parent = existing
+			}
+			existing.children = append(existing.children, c.children...)
+		case existing.msg == nil:
+			c.parent = existing
+			existing.children = append(existing.children, c)
+		case c.msg == nil:
+			// 占位容器取代已有的根，已有的根成为其子节点
+			existing.parent = c
+			c.children = append(c.children, existing)
+			subjects[base] = c
+			replaceContainer(out, existing, c)
+		case isReply(subject) && !isReply(existing.subject()):
+			c.parent = existing
+			existing.children = append(existing.children, c)
+		case !isReply(subject) && isReply(existing.subject()):
+			existing.parent = c
+			c.children = append(c.children, existing)
+			subjects[base] = c
+			replaceContainer(out, existing, c)
+		default:
+			// 都不是回复或都是回复：放到同一个占位容器下
+			dummy := &jwzContainer{children: []*jwzContainer{existing, c}}
+			existing.parent = dummy
+			c.parent = dummy
+			subjects[base] = dummy
+			replaceContainer(out, existing, dummy)
+		}
+	}
+	return out
+}
+
+// replaceContainer 在列表中用new替换old
+func replaceContainer(list []*jwzContainer, old, new *jwzContainer) {
+	for i, c := range list {
+		if c == old {
+			list[i] = new
+			return
+		}
+	}
+}
+
+// sortContainers 按时间排序，时间相同时按邮件ID排序以保证结果稳定
+func sortContainers(containers []*jwzContainer) {
+	sort.SliceStable(containers, func(i, j int) bool {
+		ti, iok := containers[i].date()
+		tj, jok := containers[j].date()
+		if iok && jok && ti != tj {
+			return ti < tj
+		}
+		return containers[i].id < containers[j].id
+	})
+}
+
+// containerThread 将容器转换为会话节点
+func containerThread(c *jwzContainer) *Thread {
+	var t *Thread
+	if c.msg != nil {
+		t = newMessageThread(c.msg)
+	} else {
+		t = &Thread{MessageID: c.id}
+		if len(c.id) > 0 && c.id[0] == 0 {
+			t.MessageID = ""
+		}
+	}
+
+	sortContainers(c.children)
+	for _, child := range c.children {
+		t.Children = append(t.Children, containerThread(child))
+	}
+	return t
+}
@@ -0,0 +1,308 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MailboxRole 邮箱的特殊用途角色（RFC 6154 SPECIAL-USE）
+type MailboxRole string
+
+const (
+	MailboxRoleNone      MailboxRole = ""          // 普通邮箱
+	MailboxRoleInbox     MailboxRole = "inbox"     // 收件箱
+	MailboxRoleAll       MailboxRole = "all"       // 所有邮件
+	MailboxRoleArchive   MailboxRole = "archive"   // 归档
+	MailboxRoleDrafts    MailboxRole = "drafts"    // 草稿箱
+	MailboxRoleFlagged   MailboxRole = "flagged"   // 星标邮件
+	MailboxRoleJunk      MailboxRole = "junk"      // 垃圾邮件
+	MailboxRoleSent      MailboxRole = "sent"      // 已发送
+	MailboxRoleTrash     MailboxRole = "trash"     // 已删除
+	MailboxRoleImportant MailboxRole = "important" // 重要邮件（RFC 8457）
+)
+
+// specialUseRoles SPECIAL-USE属性与角色的对应关系
+var specialUseRoles = map[imap.MailboxAttr]MailboxRole{
+	imap.MailboxAttrAll:       MailboxRoleAll,
+	imap.MailboxAttrArchive:   MailboxRoleArchive,
+	imap.MailboxAttrDrafts:    MailboxRoleDrafts,
+	imap.MailboxAttrFlagged:   MailboxRoleFlagged,
+	imap.MailboxAttrJunk:      MailboxRoleJunk,
+	imap.MailboxAttrSent:      MailboxRoleSent,
+	imap.MailboxAttrTrash:     MailboxRoleTrash,
+	imap.MailboxAttrImportant: MailboxRoleImportant,
+}
+
+// roleNameHints 服务器未声明SPECIAL-USE时，根据邮箱名称推测角色
+// 名称均为小写，与邮箱层级中的最后一段比较
+var roleNameHints = map[MailboxRole][]string{
+	MailboxRoleSent:    {"sent", "sent items", "sent messages", "sent mail", "已发送", "已发送邮件", "已发邮件"},
+	MailboxRoleDrafts:  {"drafts", "draft", "草稿箱", "草稿"},
+	MailboxRoleTrash:   {"trash", "deleted", "deleted items", "deleted messages", "bin", "已删除", "已删除邮件"},
+	MailboxRoleJunk:    {"junk", "spam", "junk e-mail", "junk email", "bulk mail", "垃圾邮件", "垃圾箱"},
+	MailboxRoleArchive: {"archive", "archives", "归档"},
+	MailboxRoleAll:     {"all mail", "所有邮件"},
+	MailboxRoleFlagged: {"starred", "flagged", "星标邮件"},
+}
+
+// MailboxInfo 邮箱详细信息
+type MailboxInfo struct {
+	Name      string             // 邮箱完整名称，如"[Gmail]/Sent Mail"
+	Delimiter rune               // 层级分隔符，为0表示服务器不支持层级
+	Attrs     []imap.MailboxAttr // 服务器返回的邮箱属性
+	Role      MailboxRole        // 邮箱角色
+	RoleGuess bool               // 角色是否由名称推测得到（而非SPECIAL-USE属性）
+}
+
+// HasAttr 判断邮箱是否带有指定属性（忽略大小写）
+func (m *MailboxInfo) HasAttr(attr imap.MailboxAttr) bool {
+	for _, a := range m.Attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectable 邮箱是否可以被SELECT
+func (m *MailboxInfo) Selectable() bool {
+	return !m.HasAttr(imap.MailboxAttrNoSelect) && !m.HasAttr(imap.MailboxAttrNonExistent)
+}
+
+// HasChildren 邮箱是否包含子邮箱
+func (m *MailboxInfo) HasChildren() bool {
+	return m.HasAttr(imap.MailboxAttrHasChildren)
+}
+
+// Path 按分隔符拆分后的邮箱层级路径
+func (m *MailboxInfo) Path() []string {
+	if m.Delimiter == 0 {
+		return []string{m.Name}
+	}
+	return strings.Split(m.Name, string(m.Delimiter))
+}
+
+// ShortName 邮箱层级中的最后一段名称，如"[Gmail]/Sent Mail"返回"Sent Mail"
+func (m *MailboxInfo) ShortName() string {
+	path := m.Path()
+	return path[len(path)-1]
+}
+
+// Parent 父邮箱的完整名称，顶层邮箱返回空字符串
+func (m *MailboxInfo) Parent() string {
+	path := m.Path()
+	if len(path) < 2 {
+		return ""
+	}
+	return strings.Join(path[:len(path)-1], string(m.Delimiter))
+}
+
+// MailboxNode 邮箱树节点
+type MailboxNode struct {
+	*MailboxInfo
+	Children []*MailboxNode
+}
+
+// newMailboxInfo 将LIST响应转换为MailboxInfo
+func newMailboxInfo(data *imap.ListData) *MailboxInfo {
+	info := &MailboxInfo{
+		Name:      data.Mailbox,
+		Delimiter: data.Delim,
+		Attrs:     data.Attrs,
+	}
+
+	if strings.EqualFold(info.Name, "INBOX") {
+		info.Role = MailboxRoleInbox
+		return info
+	}
+
+	for _, attr := range data.Attrs {
+		for specialAttr, role := range specialUseRoles {
+			if strings.EqualFold(string(attr), string(specialAttr)) {
+				info.Role = role
+				return info
+			}
+		}
+	}
+	return info
+}
+
+// guessMailboxRole 根据邮箱名称推测角色
+func guessMailboxRole(info *MailboxInfo) MailboxRole {
+	name := strings.ToLower(strings.TrimSpace(info.ShortName()))
+	for role, hints := range roleNameHints {
+		for _, hint := range hints {
+			if name == hint {
+				return role
+			}
+		}
+	}
+	return MailboxRoleNone
+}
+
+// applyRoleHeuristics 为未声明SPECIAL-USE属性的邮箱推测角色
+// 服务器已为某个角色声明了属性时，不会再为该角色推测其他邮箱
+func applyRoleHeuristics(infos []*MailboxInfo) {
+	declared := make(map[MailboxRole]bool)
+	for _, info := range infos {
+		if info.Role != MailboxRoleNone {
+			declared[info.Role] = true
+		}
+	}
+
+	for _, info := range infos {
+		if info.Role != MailboxRoleNone || !info.Selectable() {
+			continue
+		}
+		role := guessMailboxRole(info)
+		if role == MailboxRoleNone || declared[role] {
+			continue
+		}
+		info.Role = role
+		info.RoleGuess = true
+	}
+}
+
+// ListMailboxInfo 获取所有邮箱的详细信息
+// 服务器支持SPECIAL-USE时使用其声明的角色，否则根据常见名称推测
+// 返回:
+//   - []*MailboxInfo: 邮箱信息列表
+//   - error: 获取过程中的错误
+func (c *ImapClient) ListMailboxInfo() ([]*MailboxInfo, error) {
+	var infos []*MailboxInfo
+	err := c.withConn(func() (err error) {
+		infos, err = c.listMailboxInfo()
+		return err
+	})
+	return infos, err
+}
+
+// listMailboxInfo ListMailboxInfo的实现
+func (c *ImapClient) listMailboxInfo() ([]*MailboxInfo, error) {
+	var options *imap.ListOptions
+	caps := c.client.Caps()
+	if caps.Has(imap.CapSpecialUse) && caps.Has(imap.CapListExtended) {
+		options = &imap.ListOptions{ReturnSpecialUse: true}
+	}
+
+	mailboxes, err := c.client.List("", "*", options).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*MailboxInfo, 0, len(mailboxes))
+	for _, m := range mailboxes {
+		infos = append(infos, newMailboxInfo(m))
+	}
+	applyRoleHeuristics(infos)
+
+	return infos, nil
+}
+
+// MailboxTree 获取按层级组织的邮箱树
+// 服务器未返回的中间层级会以不可选择(\Noselect)的节点补齐
+// 返回:
+//   - []*MailboxNode: 顶层邮箱节点列表
+//   - error: 获取过程中的错误
+func (c *ImapClient) MailboxTree() ([]*MailboxNode, error) {
+	infos, err := c.ListMailboxInfo()
+	if err != nil {
+		return nil, err
+	}
+	return BuildMailboxTree(infos), nil
+}
+
+// FindMailboxByRole 查找指定角色的邮箱
+// 参数:
+//   - role: 邮箱角色，如MailboxRoleSent
+//
+// 返回:
+//   - *MailboxInfo: 找到的邮箱信息
+//   - error: 获取过程中的错误，未找到时同样返回错误
+func (c *ImapClient) FindMailboxByRole(role MailboxRole) (*MailboxInfo, error) {
+	infos, err := c.ListMailboxInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	info := FindMailboxByRole(infos, role)
+	if info == nil {
+		return nil, fmt.Errorf("mailbox with role %q not found", role)
+	}
+	return info, nil
+}
+
+// FindMailboxByRole 在邮箱列表中查找指定角色的邮箱
+// 优先返回服务器声明的角色，其次返回根据名称推测的角色，未找到返回nil
+func FindMailboxByRole(infos []*MailboxInfo, role MailboxRole) *MailboxInfo {
+	var guessed *MailboxInfo
+	for _, info := range infos {
+		if info.Role != role {
+			continue
+		}
+		if !info.RoleGuess {
+			return info
+		}
+		if guessed == nil {
+			guessed = info
+		}
+	}
+	return guessed
+}
+
+// BuildMailboxTree 将平铺的邮箱列表构建为树
+func BuildMailboxTree(infos []*MailboxInfo) []*MailboxNode {
+	nodes := make(map[string]*MailboxNode, len(infos))
+	for _, info := range infos {
+		nodes[info.Name] = &MailboxNode{MailboxInfo: info}
+	}
+
+	var roots []*MailboxNode
+	var attach func(node *MailboxNode)
+	attach = func(node *MailboxNode) {
+		parentName := node.Parent()
+		if parentName == "" {
+			roots = append(roots, node)
+			return
+		}
+
+		parent, ok := nodes[parentName]
+		if !ok {
+			// 补齐服务器未返回的中间层级
+			parent = &MailboxNode{MailboxInfo: &MailboxInfo{
+				Name:      parentName,
+				Delimiter: node.Delimiter,
+				Attrs:     []imap.MailboxAttr{imap.MailboxAttrNoSelect, imap.MailboxAttrHasChildren},
+			}}
+			nodes[parentName] = parent
+			attach(parent)
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	for _, info := range infos {
+		attach(nodes[info.Name])
+	}
+
+	sortMailboxNodes(roots)
+	return roots
+}
+
+// sortMailboxNodes 按名称排序邮箱树，INBOX始终排在最前
+func sortMailboxNodes(nodes []*MailboxNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Role == MailboxRoleInbox {
+			return true
+		}
+		if nodes[j].Role == MailboxRoleInbox {
+			return false
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortMailboxNodes(node.Children)
+	}
+}
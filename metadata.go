@@ -0,0 +1,140 @@
+package email
+
+import (
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// GetMetadata 获取邮箱的元数据(GETMETADATA，RFC 5464)
+// 条目名称以"/private/"（仅当前用户可见）或"/shared/"（所有用户可见）开头，
+// 应用自定义的条目通常放在"/private/vendor/<应用名>/"下
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - entries: 要获取的条目名称
+//
+// 返回:
+//   - map[string]string: 条目名称到值的映射，不存在的条目不包含在内
+//   - error: 服务器不支持METADATA扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetMetadata(mailbox string, entries ...string) (map[string]string, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	return c.getMetadata(mailbox, entries, nil)
+}
+
+// GetMetadataTree 获取邮箱中entry及其下所有子条目的元数据（DEPTH infinity）
+// 例如entry为"/private/vendor/myapp"时返回该应用保存的全部设置
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - entry: 条目名称
+//
+// 返回:
+//   - map[string]string: 条目名称到值的映射
+//   - error: 服务器不支持METADATA扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetMetadataTree(mailbox, entry string) (map[string]string, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	return c.getMetadata(mailbox, []string{entry}, &imapclient.GetMetadataOptions{
+		Depth: imapclient.GetMetadataDepthInfinity,
+	})
+}
+
+// SetMetadata 设置邮箱的元数据(SETMETADATA)
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - entries: 条目名称到值的映射，值为空字符串时删除该条目
+//
+// 返回:
+//   - error: 服务器不支持METADATA扩展时返回包装了ErrNotSupported的错误；
+//     超过服务器的大小或数量限制时返回带有METADATA响应码的*imap.Error
+func (c *ImapClient) SetMetadata(mailbox string, entries map[string]string) error {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	return c.setMetadata(mailbox, entries)
+}
+
+// GetServerMetadata 获取服务器级别的元数据，如"/shared/comment"、"/shared/admin"
+// 参数:
+//   - entries: 要获取的条目名称
+//
+// 返回:
+//   - map[string]string: 条目名称到值的映射，不存在的条目不包含在内
+//   - error: 服务器不支持METADATA或METADATA-SERVER扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetServerMetadata(entries ...string) (map[string]string, error) {
+	return c.getMetadata("", entries, nil)
+}
+
+// GetServerMetadataTree 获取服务器级别的entry及其下所有子条目的元数据
+// 参数:
+//   - entry: 条目名称
+//
+// 返回:
+//   - map[string]string: 条目名称到值的映射
+//   - error: 服务器不支持METADATA或METADATA-SERVER扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetServerMetadataTree(entry string) (map[string]string, error) {
+	return c.getMetadata("", []string{entry}, &imapclient.GetMetadataOptions{
+		Depth: imapclient.GetMetadataDepthInfinity,
+	})
+}
+
+// SetServerMetadata 设置服务器级别的元数据
+// 参数:
+//   - entries: 条目名称到值的映射，值为空字符串时删除该条目
+//
+// 返回:
+//   - error: 服务器不支持METADATA或METADATA-SERVER扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) SetServerMetadata(entries map[string]string) error {
+	return c.setMetadata("", entries)
+}
+
+// requireMetadata 检查服务器是否支持元数据：邮箱的元数据需要METADATA，
+// 服务器级别（mailbox为空）的元数据只需要METADATA-SERVER
+func (c *ImapClient) requireMetadata(mailbox string) error {
+	if mailbox == "" && c.client.Caps().Has(imap.CapMetadataServer) {
+		return nil
+	}
+	return c.requireCap(imap.CapMetadata)
+}
+
+// getMetadata GetMetadata和GetServerMetadata的实现，mailbox为空表示服务器级别
+func (c *ImapClient) getMetadata(mailbox string, entries []string, options *imapclient.GetMetadataOptions) (map[string]string, error) {
+	values := make(map[string]string)
+	err := c.withConn(func() error {
+		if err := c.requireMetadata(mailbox); err != nil {
+			return err
+		}
+		data, err := c.client.GetMetadata(mailbox, entries, options).Wait()
+		if err != nil {
+			return err
+		}
+		for name, value := range data.Entries {
+			if value != nil {
+				values[name] = string(*value)
+			}
+		}
+		return nil
+	})
+	return values, err
+}
+
+// setMetadata SetMetadata和SetServerMetadata的实现，mailbox为空表示服务器级别
+func (c *ImapClient) setMetadata(mailbox string, entries map[string]string) error {
+	values := make(map[string]*[]byte, len(entries))
+	for name, value := range entries {
+		if value == "" {
+			values[name] = nil // NIL删除条目
+			continue
+		}
+		b := []byte(value)
+		values[name] = &b
+	}
+
+	return c.withConn(func() error {
+		if err := c.requireMetadata(mailbox); err != nil {
+			return err
+		}
+		return c.client.SetMetadata(mailbox, values).Wait()
+	})
+}
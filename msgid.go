@@ -0,0 +1,149 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/go-enols/go-log"
+)
+
+// AllMailboxes 作为邮箱名称传给GetByMessageID时，依次在所有可选择的邮箱中查找
+const AllMailboxes = "*"
+
+// ErrMessageNotFound 没有找到指定的邮件
+var ErrMessageNotFound = errors.New("message not found")
+
+// GetByMessageID 根据Message-ID头获取邮件
+// 使用SEARCH HEADER在服务器端查找，再比较完整的Message-ID排除部分匹配的结果
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"；为AllMailboxes时先查找收件箱，再依次查找其他邮箱
+//   - id: Message-ID，可以带或不带尖括号
+//
+// 返回:
+//   - *ParsedMessage: 解析后的邮件
+//   - error: 没有找到时返回包装了ErrMessageNotFound的错误
+func (c *ImapClient) GetByMessageID(mailbox, id string) (*ParsedMessage, error) {
+	var msg *ParsedMessage
+	err := c.withConn(func() (err error) {
+		msg, err = c.getByMessageID(mailbox, id)
+		return err
+	})
+	return msg, err
+}
+
+// getByMessageID GetByMessageID的实现
+func (c *ImapClient) getByMessageID(mailbox, id string) (*ParsedMessage, error) {
+	id = normalizeMessageID(id)
+	if id == "" {
+		return nil, fmt.Errorf("empty message id")
+	}
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if mailbox != AllMailboxes {
+		msg, err := c.searchMessageID(mailbox, id)
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			return nil, fmt.Errorf("<%s> in %s: %w", id, mailbox, ErrMessageNotFound)
+		}
+		return msg, nil
+	}
+
+	infos, err := c.listMailboxInfo()
+	if err != nil {
+		return nil, err
+	}
+	mailboxes := []string{"INBOX"}
+	for _, info := range infos {
+		if strings.EqualFold(info.Name, "INBOX") ||
+			info.HasAttr(imap.MailboxAttrNoSelect) || info.HasAttr(imap.MailboxAttrNonExistent) {
+			continue
+		}
+		mailboxes = append(mailboxes, info.Name)
+	}
+
+	for _, name := range mailboxes {
+		msg, err := c.searchMessageID(name, id)
+		if err != nil {
+			var imapErr *imap.Error
+			if errors.As(err, &imapErr) {
+				log.Debugf("search message id in %s: %v", name, err)
+				continue
+			}
+			return nil, err
+		}
+		if msg != nil {
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("<%s>: %w", id, ErrMessageNotFound)
+}
+
+// searchMessageID 在一个邮箱中查找Message-ID完全相同的邮件，没有找到时返回nil
+func (c *ImapClient) searchMessageID(mailbox, id string) (*ParsedMessage, error) {
+	// 选择邮箱
+	_, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.client.UIDSearch(&imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{
+			{Key: "Message-ID", Value: id},
+		},
+	}, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	uids := data.AllUIDs()
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	messages, err := c.fetchMessages(imap.UIDSetNum(uids...), (&FetchOptions{}).imapOptions(), false)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		if normalizeMessageID(msg.MessageID) == id {
+			return msg, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetByMessageID 根据Message-ID头获取邮件
+// POP3不支持搜索，使用TOP命令从最新的邮件开始逐封读取邮件头比较
+// 参数:
+//   - mailbox: POP3只有一个邮箱，忽略该参数
+//   - id: Message-ID，可以带或不带尖括号
+//
+// 返回:
+//   - *ParsedMessage: 解析后的邮件
+//   - error: 没有找到时返回包装了ErrMessageNotFound的错误
+func (c *POP3Client) GetByMessageID(mailbox, id string) (*ParsedMessage, error) {
+	id = normalizeMessageID(id)
+	if id == "" {
+		return nil, fmt.Errorf("empty message id")
+	}
+
+	count, _, err := c.conn.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("get message count: %w", err)
+	}
+
+	for i := count; i >= 1; i-- {
+		entity, err := c.conn.Top(i, 0)
+		if err != nil {
+			return nil, fmt.Errorf("read headers of message %d: %w", i, err)
+		}
+		if normalizeMessageID(entity.Header.Get("Message-ID")) == id {
+			return c.retrieve(i, false)
+		}
+	}
+	return nil, fmt.Errorf("<%s>: %w", id, ErrMessageNotFound)
+}
@@ -0,0 +1,448 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/go-enols/go-log"
+)
+
+// defaultStatusPollInterval 轮询模式下两轮STATUS之间的默认间隔
+const defaultStatusPollInterval = time.Minute
+
+// MultiWatchMode 多邮箱监听模式
+type MultiWatchMode int
+
+const (
+	// MultiWatchAuto 自动选择：服务器支持NOTIFY时使用NOTIFY；否则支持IDLE且连接数允许时
+	// 为每个邮箱使用IDLE连接，其余情况轮询
+	MultiWatchAuto MultiWatchMode = iota
+	// MultiWatchIdle 为每个邮箱单独建立一个IDLE连接
+	MultiWatchIdle
+	// MultiWatchPoll 每个账号使用一个连接，轮流对各邮箱发送STATUS
+	MultiWatchPoll
+	// MultiWatchNotify 每个账号通过一个NOTIFY(RFC 5465)连接接收所有邮箱的变化，
+	// 另用一个连接获取新邮件，服务器不支持NOTIFY时报错
+	MultiWatchNotify
+)
+
+// WatchTarget 要监听的账号及其邮箱
+type WatchTarget struct {
+	Account   string      // 账号标识，用于区分事件来源，默认为Login.User
+	Login     LoginParams // 登录参数，协议必须为IMAP
+	Mailboxes []string    // 要监听的邮箱，默认为INBOX
+}
+
+// MultiWatchOptions 多邮箱监听选项
+type MultiWatchOptions struct {
+	Mode         MultiWatchMode // 监听模式
+	PollInterval time.Duration  // 轮询模式下两轮STATUS之间的间隔，默认1分钟
+	MaxConns     int            // 自动模式下每个账号最多建立的IDLE连接数，默认5
+}
+
+// AccountEvent 带有账号信息的邮箱事件
+type AccountEvent struct {
+	Account string // 事件所属的账号
+	*MailboxEvent
+}
+
+// WatchAccounts 同时监听多个账号的多个邮箱，将新邮件事件合并到一个通道中
+// 服务器支持NOTIFY(RFC 5465)时每个账号只需一个监听连接，否则使用每个邮箱一个IDLE连接
+// 或每个账号一个连接轮询STATUS。
+// 只转发NewMessage、Reconnected和Error事件；连接断开时自动重连，
+// 重连失败时只停止该账号的监听，其余账号继续工作。
+// ctx被取消或所有账号都停止后关闭通道，并关闭所有连接
+// 参数:
+//   - ctx: 用于停止监听的上下文
+//   - targets: 要监听的账号列表
+//   - options: 监听选项，可为nil
+//
+// 返回:
+//   - <-chan *AccountEvent: 合并后的事件通道
+//   - error: 参数错误
+func WatchAccounts(ctx context.Context, targets []*WatchTarget, options *MultiWatchOptions) (<-chan *AccountEvent, error) {
+	if options == nil {
+		options = &MultiWatchOptions{}
+	}
+	for _, t := range targets {
+		if t.Login.Proto != IMAP {
+			return nil, fmt.Errorf("account %s: only IMAP accounts can be watched", t.Login.User)
+		}
+	}
+
+	events := make(chan *AccountEvent, 64)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		target := *t
+		if target.Account == "" {
+			target.Account = t.Login.User
+		}
+		if len(target.Mailboxes) == 0 {
+			target.Mailboxes = []string{"INBOX"}
+		}
+		w := &accountWatcher{
+			target:  &target,
+			options: options,
+			events:  events,
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// accountWatcher 单个账号的监听者
+type accountWatcher struct {
+	target  *WatchTarget
+	options *MultiWatchOptions
+	events  chan<- *AccountEvent
+}
+
+func (w *accountWatcher) run(ctx context.Context) {
+	client, err := w.login()
+	if err != nil {
+		w.emitError(ctx, "", err)
+		return
+	}
+
+	mode := w.options.Mode
+	if mode == MultiWatchAuto {
+		maxConns := w.options.MaxConns
+		if maxConns <= 0 {
+			maxConns = 5
+		}
+		caps := client.client.Caps()
+		hasIdle := caps.Has(imap.CapIdle) || caps.Has(imap.CapIMAP4rev2)
+		switch {
+		case caps.Has(imap.CapNotify):
+			mode = MultiWatchNotify
+		case hasIdle && len(w.target.Mailboxes) <= maxConns:
+			mode = MultiWatchIdle
+		default:
+			mode = MultiWatchPoll
+		}
+	}
+
+	switch mode {
+	case MultiWatchPoll:
+		defer client.Close()
+		w.poll(ctx, client)
+		return
+	case MultiWatchNotify:
+		defer client.Close()
+		w.notify(ctx, client)
+		return
+	}
+
+	// 每个邮箱一个IDLE连接，第一个邮箱复用已建立的连接
+	var wg sync.WaitGroup
+	for i, mailbox := range w.target.Mailboxes {
+		c := client
+		if i > 0 {
+			c, err = w.login()
+			if err != nil {
+				w.emitError(ctx, mailbox, err)
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(c *ImapClient, mailbox string) {
+			defer wg.Done()
+			defer c.Close()
+			w.idle(ctx, c, mailbox)
+		}(c, mailbox)
+	}
+	wg.Wait()
+}
+
+// login 登录账号
+func (w *accountWatcher) login() (*ImapClient, error) {
+	reader, err := createIMAPClient(w.target.Login)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := reader.(*ImapClient)
+	if !ok || client == nil {
+		return nil, fmt.Errorf("login failed")
+	}
+	return client, nil
+}
+
+// idle 使用Watch监听单个邮箱，转发新邮件和错误事件
+func (w *accountWatcher) idle(ctx context.Context, client *ImapClient, mailbox string) {
+	events, err := client.Watch(ctx, mailbox)
+	if err != nil {
+		w.emitError(ctx, mailbox, err)
+		return
+	}
+
+	for ev := range events {
+		switch ev.Type {
+		case MailboxEventNewMessage, MailboxEventError, MailboxEventReconnected:
+			w.emit(ctx, &AccountEvent{Account: w.target.Account, MailboxEvent: ev})
+		}
+	}
+}
+
+// poll 使用一个连接轮流对各邮箱发送STATUS，发现UIDNEXT变化时获取新邮件
+func (w *accountWatcher) poll(ctx context.Context, client *ImapClient) {
+	interval := w.options.PollInterval
+	if interval <= 0 {
+		interval = defaultStatusPollInterval
+	}
+
+	// 记录每个邮箱上一次的状态，首轮只记录不产生事件
+	last := make(map[string]*imap.StatusData)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, mailbox := range w.target.Mailboxes {
+			if err := w.pollMailbox(ctx, client, mailbox, last); err != nil {
+				w.emitError(ctx, mailbox, err)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollMailbox 检查单个邮箱是否有新邮件
+func (w *accountWatcher) pollMailbox(ctx context.Context, client *ImapClient, mailbox string, last map[string]*imap.StatusData) error {
+	return client.withConn(func() error {
+		return w.checkMailbox(ctx, client, mailbox, last)
+	})
+}
+
+// checkMailbox pollMailbox的实现
+func (w *accountWatcher) checkMailbox(ctx context.Context, client *ImapClient, mailbox string, last map[string]*imap.StatusData) error {
+	status, err := client.client.Status(mailbox, &imap.StatusOptions{
+		NumMessages: true,
+		UIDNext:     true,
+		UIDValidity: true,
+	}).Wait()
+	if err != nil {
+		return err
+	}
+
+	prev := last[mailbox]
+	if prev == nil || prev.UIDValidity != status.UIDValidity || status.UIDNext <= prev.UIDNext {
+		last[mailbox] = status
+		return nil
+	}
+
+	// 获取新邮件的摘要信息
+	_, err = client.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	uidSet := imap.UIDSet{{Start: prev.UIDNext, Stop: status.UIDNext - 1}}
+	msgs, err := client.client.Fetch(uidSet, headersFetchOptions()).Collect()
+	if err != nil {
+		return err
+	}
+
+	for _, buf := range msgs {
+		msg, err := client.parseMessageBuffer(buf)
+		if err != nil {
+			return err
+		}
+		msg.Attachments = client.lazyAttachments(mailbox, msg)
+		w.emit(ctx, &AccountEvent{
+			Account: w.target.Account,
+			MailboxEvent: &MailboxEvent{
+				Type:    MailboxEventNewMessage,
+				Mailbox: mailbox,
+				SeqNum:  buf.SeqNum,
+				UID:     buf.UID,
+				Flags:   buf.Flags,
+				Message: msg,
+			},
+		})
+	}
+	// 全部处理完才记录新状态，断线重试时不会漏掉新邮件
+	last[mailbox] = status
+	return nil
+}
+
+// notify 通过NOTIFY连接接收各邮箱的STATUS变化，发现变化时使用client获取新邮件
+// NOTIFY连接断开时按重连策略重新建立，成功后发送Reconnected事件并补发期间的新邮件
+func (w *accountWatcher) notify(ctx context.Context, client *ImapClient) {
+	if err := client.withConn(func() error { return client.requireCap(imap.CapNotify) }); err != nil {
+		w.emitError(ctx, "", err)
+		return
+	}
+
+	// 首轮只记录各邮箱的状态
+	last := make(map[string]*imap.StatusData)
+	var cause error
+	for ctx.Err() == nil {
+		conn, err := w.dialNotify(ctx, client, last)
+		if err != nil {
+			if ctx.Err() == nil {
+				w.emitError(ctx, "", err)
+			}
+			return
+		}
+		if cause != nil {
+			w.emit(ctx, &AccountEvent{
+				Account:      w.target.Account,
+				MailboxEvent: &MailboxEvent{Type: MailboxEventReconnected, Err: cause},
+			})
+		}
+
+		cause = w.readNotify(ctx, client, conn, last)
+		conn.conn.Close()
+		var statusErr *rawStatusError
+		if cause == nil || errors.As(cause, &statusErr) {
+			if cause != nil && ctx.Err() == nil {
+				w.emitError(ctx, "", cause)
+			}
+			return
+		}
+		log.Debugf("notify connection to %s lost: %v", w.target.Login.Host, cause)
+	}
+}
+
+// dialNotify 按重连策略建立NOTIFY连接并订阅各邮箱的新邮件，然后检查一遍各邮箱
+func (w *accountWatcher) dialNotify(ctx context.Context, client *ImapClient, last map[string]*imap.StatusData) (*rawIMAP, error) {
+	policy := w.target.Login.Reconnect.withDefaults()
+	attempts := policy.MaxAttempts
+	if attempts < 0 {
+		attempts = 1
+	}
+
+	mailboxes := make([]string, len(w.target.Mailboxes))
+	for i, mailbox := range w.target.Mailboxes {
+		mailboxes[i] = quoteIMAP(encodeMailboxName(mailbox))
+	}
+	// MessageNew和MessageExpunge必须同时指定；未选中的邮箱发生变化时服务器发送STATUS响应
+	set := "(mailboxes (" + strings.Join(mailboxes, " ") + ") (MessageNew MessageExpunge))"
+
+	backoff := policy.MinBackoff
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, policy.MaxBackoff)
+		}
+
+		conn, err := dialRawIMAP(&w.target.Login)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := conn.command("NOTIFY", "SET", set); err != nil {
+			conn.conn.Close()
+			var statusErr *rawStatusError
+			if errors.As(err, &statusErr) {
+				return nil, fmt.Errorf("notify: %w", err)
+			}
+			lastErr = err
+			continue
+		}
+
+		// 订阅之后再检查，期间到达的邮件不会遗漏
+		for _, mailbox := range w.target.Mailboxes {
+			if err := w.pollMailbox(ctx, client, mailbox, last); err != nil {
+				conn.conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+	return nil, fmt.Errorf("notify connection to %s failed after %d attempts: %w", w.target.Login.Host, attempts, lastErr)
+}
+
+// readNotify 读取NOTIFY连接上的推送，直到ctx被取消（返回nil）或连接出错
+// 较长时间没有推送时发送NOOP保持连接
+func (w *accountWatcher) readNotify(ctx context.Context, client *ImapClient, conn *rawIMAP, last map[string]*imap.StatusData) error {
+	// ctx被取消时关闭连接以结束阻塞的读取
+	stop := context.AfterFunc(ctx, func() { conn.conn.Close() })
+	defer stop()
+
+	for {
+		resp, err := conn.readResponse()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			var responses []rawResponse
+			if responses, err = conn.command("NOOP"); err == nil {
+				err = w.handleNotify(ctx, client, responses, last)
+			}
+		} else if err == nil && len(resp) > 0 && resp[0] == rawAtom("*") {
+			err = w.handleNotify(ctx, client, []rawResponse{rawResponse(resp[1:])}, last)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleNotify 处理NOTIFY推送的STATUS响应，对发生变化的邮箱获取新邮件
+func (w *accountWatcher) handleNotify(ctx context.Context, client *ImapClient, responses []rawResponse, last map[string]*imap.StatusData) error {
+	for _, resp := range responses {
+		if len(resp) < 2 || !strings.EqualFold(atomString(resp[0]), "STATUS") {
+			continue
+		}
+		name := decodeMailboxName(atomString(resp[1]))
+		for _, mailbox := range w.target.Mailboxes {
+			if mailbox == name || strings.EqualFold(mailbox, "INBOX") && strings.EqualFold(name, "INBOX") {
+				if err := w.pollMailbox(ctx, client, mailbox, last); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (w *accountWatcher) emitError(ctx context.Context, mailbox string, err error) {
+	w.emit(ctx, &AccountEvent{
+		Account: w.target.Account,
+		MailboxEvent: &MailboxEvent{
+			Type:    MailboxEventError,
+			Mailbox: mailbox,
+			Err:     err,
+		},
+	})
+}
+
+// emit 发送事件，ctx被取消时放弃发送
+func (w *accountWatcher) emit(ctx context.Context, ev *AccountEvent) {
+	select {
+	case w.events <- ev:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,434 @@
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// ErrInvalidCursor 分页游标无效或已过期，如IMAP邮箱的UIDVALIDITY发生变化、POP3游标对应的邮件已被删除
+var ErrInvalidCursor = errors.New("invalid or expired page cursor")
+
+// defaultPageSize 默认每页邮件数量
+const defaultPageSize = 20
+
+// PageOrder 分页的排序方向
+type PageOrder int
+
+const (
+	NewestFirst PageOrder = iota // 从新到旧
+	OldestFirst                  // 从旧到新
+)
+
+// PageOptions 分页读取邮件的设置
+type PageOptions struct {
+	Mailbox string        // 邮箱名称，默认为"INBOX"；POP3只有一个邮箱，忽略该字段
+	Size    int           // 每页邮件数量，默认20
+	Order   PageOrder     // 排序方向，默认从新到旧
+	Fetch   *FetchOptions // 获取邮件内容的设置，nil表示获取完整邮件；POP3只支持KeepRaw
+}
+
+// mailbox 返回邮箱名称，未设置时为"INBOX"
+func (o *PageOptions) mailbox() string {
+	if o.Mailbox == "" {
+		return "INBOX"
+	}
+	return o.Mailbox
+}
+
+// size 返回每页邮件数量，未设置时为默认值
+func (o *PageOptions) size() int {
+	if o.Size <= 0 {
+		return defaultPageSize
+	}
+	return o.Size
+}
+
+// fetch 返回获取邮件内容的设置
+func (o *PageOptions) fetch() *FetchOptions {
+	if o.Fetch == nil {
+		return &FetchOptions{}
+	}
+	return o.Fetch
+}
+
+// Page 一页邮件
+type Page struct {
+	Messages   []*ParsedMessage // 本页的邮件，按PageOptions.Order排序
+	NextCursor string           // 下一页的游标，没有更多邮件时为空
+	Total      int              // 邮箱中的邮件总数
+}
+
+// PageReader 支持按游标分页读取邮件的客户端，ImapClient和POP3Client都实现了该接口
+type PageReader interface {
+	// ListPage 读取cursor之后的一页邮件，cursor为空表示第一页
+	ListPage(cursor string, options *PageOptions) (*Page, error)
+}
+
+var (
+	_ PageReader = (*ImapClient)(nil)
+	_ PageReader = (*POP3Client)(nil)
+)
+
+// Paginator 依次读取邮箱中的每一页邮件
+// 游标基于邮件的UID而不是序号，其他客户端删除邮件后翻页也不会重复或遗漏
+type Paginator struct {
+	reader  PageReader
+	options PageOptions
+	cursor  string
+	done    bool
+}
+
+// NewPaginator 创建分页器
+// 参数:
+//   - reader: ImapClient或POP3Client
+//   - options: 分页设置，nil表示使用默认设置
+//   - cursor: [可选] 从之前保存的游标处继续，如Web界面请求中带回的游标
+//
+// 返回:
+//   - *Paginator: 分页器
+func NewPaginator(reader PageReader, options *PageOptions, cursor ...string) *Paginator {
+	p := &Paginator{reader: reader}
+	if options != nil {
+		p.options = *options
+	}
+	if len(cursor) > 0 {
+		p.cursor = cursor[0]
+	}
+	return p
+}
+
+// HasNext 是否还有下一页
+func (p *Paginator) HasNext() bool {
+	return !p.done
+}
+
+// Next 读取下一页邮件
+// 返回:
+//   - *Page: 下一页邮件；已经没有更多邮件时Messages为空
+//   - error: 读取过程中的错误
+func (p *Paginator) Next() (*Page, error) {
+	if p.done {
+		return &Page{}, nil
+	}
+	page, err := p.reader.ListPage(p.cursor, &p.options)
+	if err != nil {
+		return nil, err
+	}
+	p.cursor = page.NextCursor
+	p.done = page.NextCursor == ""
+	return page, nil
+}
+
+// Cursor 返回下一页的游标，可以保存后传给NewPaginator或ListPage继续读取
+func (p *Paginator) Cursor() string {
+	return p.cursor
+}
+
+// encodeCursor 将各字段编码为不透明的游标
+func encodeCursor(fields ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, ":")))
+}
+
+// decodeCursor 解码游标，返回kind之后的n个字段，最后一个字段可以包含冒号
+func decodeCursor(cursor, kind string, n int) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	fields := strings.SplitN(string(data), ":", n+1)
+	if len(fields) != n+1 || fields[0] != kind {
+		return nil, ErrInvalidCursor
+	}
+	return fields[1:], nil
+}
+
+// ListPage 按UID分页读取邮箱中的邮件
+// 游标中记录了邮箱的UIDVALIDITY和本页最后一封邮件的UID，UIDVALIDITY变化后游标失效
+// 参数:
+//   - cursor: 上一页返回的NextCursor，为空表示第一页
+//   - options: 分页设置，nil表示使用默认设置
+//
+// 返回:
+//   - *Page: 一页邮件
+//   - error: 游标无效时返回ErrInvalidCursor，或获取过程中的错误
+func (c *ImapClient) ListPage(cursor string, options *PageOptions) (*Page, error) {
+	if options == nil {
+		options = &PageOptions{}
+	}
+
+	var page *Page
+	err := c.withConn(func() (err error) {
+		page, err = c.listPage(cursor, options)
+		return err
+	})
+	return page, err
+}
+
+// listPage ListPage的实现
+func (c *ImapClient) listPage(cursor string, options *PageOptions) (*Page, error) {
+	// 选择邮箱
+	selected, err := c.selectMailbox(options.mailbox(), &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Total: int(selected.NumMessages)}
+	newestFirst := options.Order == NewestFirst
+
+	// 游标中本页最后一封邮件的UID，0表示第一页
+	var after imap.UID
+	if cursor != "" {
+		fields, err := decodeCursor(cursor, "imap", 2)
+		if err != nil {
+			return nil, err
+		}
+		validity, err1 := strconv.ParseUint(fields[0], 10, 32)
+		uid, err2 := strconv.ParseUint(fields[1], 10, 32)
+		if err1 != nil || err2 != nil || uid == 0 {
+			return nil, ErrInvalidCursor
+		}
+		if uint32(validity) != selected.UIDValidity {
+			return nil, ErrInvalidCursor
+		}
+		after = imap.UID(uid)
+		if newestFirst && after == 1 {
+			return page, nil
+		}
+	}
+
+	// 支持ESEARCH时只统计游标之后的邮件数量，再按序号获取本页的UID，不必列出邮箱中的全部UID
+	size := options.size()
+	var uids []imap.UID
+	var more bool
+	if after == 0 || c.client.Caps().Has(imap.CapESearch) {
+		uids, more, err = c.pageUIDsBySeq(after, newestFirst, size)
+	} else {
+		uids, more, err = c.pageUIDsBySearch(after, newestFirst, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current := c.client.Mailbox(); current != nil {
+		page.Total = int(current.NumMessages)
+	}
+	if len(uids) == 0 {
+		return page, nil
+	}
+
+	fetch := options.fetch()
+	if fetch.MaxSize > 0 {
+		page.Messages, err = c.fetchLimited(imap.UIDSetNum(uids...), fetch)
+	} else {
+		page.Messages, err = c.fetchMessages(imap.UIDSetNum(uids...), fetch.imapOptions(), fetch.KeepRaw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(page.Messages, func(i, j int) bool {
+		if newestFirst {
+			return page.Messages[i].UID > page.Messages[j].UID
+		}
+		return page.Messages[i].UID < page.Messages[j].UID
+	})
+
+	if more {
+		last := uids[len(uids)-1]
+		if newestFirst {
+			last = uids[0]
+		}
+		page.NextCursor = encodeCursor("imap", strconv.FormatUint(uint64(selected.UIDValidity), 10), strconv.FormatUint(uint64(last), 10))
+	}
+	return page, nil
+}
+
+// pageUIDsBySeq 通过序号确定本页邮件的UID，返回按UID升序排列的UID和是否还有更多邮件
+// 序号与UID的顺序相同，游标之前(NewestFirst)的邮件序号为1到n，之后(OldestFirst)的邮件为最后n封，
+// n由ESEARCH的COUNT得到；第一页不需要搜索
+func (c *ImapClient) pageUIDsBySeq(after imap.UID, newestFirst bool, size int) ([]imap.UID, bool, error) {
+	var lo, hi uint32
+	if after == 0 {
+		lo, hi = 1, c.client.Mailbox().NumMessages
+	} else {
+		uidRange := imap.UIDRange{Start: after + 1, Stop: 0}
+		if newestFirst {
+			uidRange = imap.UIDRange{Start: 1, Stop: after - 1}
+		}
+		data, err := c.client.UIDSearch(&imap.SearchCriteria{
+			UID: []imap.UIDSet{{uidRange}},
+		}, &imap.SearchOptions{ReturnMin: true, ReturnCount: true}).Wait()
+		if err != nil {
+			return nil, false, err
+		}
+
+		total := c.client.Mailbox().NumMessages
+		count := min(data.Count, total)
+		if newestFirst {
+			lo, hi = 1, count
+		} else {
+			// "n:*"在n大于最大UID时仍会匹配最后一封邮件
+			if count > 0 && data.Min <= uint32(after) {
+				count = 0
+			}
+			lo, hi = total-count+1, total
+		}
+	}
+	if hi < lo {
+		return nil, false, nil
+	}
+
+	more := hi-lo+1 > uint32(size)
+	if more {
+		if newestFirst {
+			lo = hi - uint32(size) + 1
+		} else {
+			hi = lo + uint32(size) - 1
+		}
+	}
+
+	data, err := c.client.Fetch(imap.SeqSet{{Start: lo, Stop: hi}}, &imap.FetchOptions{UID: true}).Collect()
+	if err != nil {
+		return nil, false, err
+	}
+	// 其他客户端在两条命令之间删除邮件时序号会变化，再按游标过滤一次
+	var uids []imap.UID
+	for _, msg := range data {
+		if pageAfter(msg.UID, after, newestFirst) {
+			uids = append(uids, msg.UID)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, more, nil
+}
+
+// pageUIDsBySearch 搜索游标之后的全部UID并取出本页的部分，用于不支持ESEARCH的服务器
+func (c *ImapClient) pageUIDsBySearch(after imap.UID, newestFirst bool, size int) ([]imap.UID, bool, error) {
+	uidRange := imap.UIDRange{Start: after + 1, Stop: 0}
+	if newestFirst {
+		uidRange = imap.UIDRange{Start: 1, Stop: after - 1}
+	}
+	data, err := c.client.UIDSearch(&imap.SearchCriteria{
+		UID: []imap.UIDSet{{uidRange}},
+	}, nil).Wait()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// "n:*"在n大于最大UID时仍会匹配最后一封邮件，需要再次过滤
+	var uids []imap.UID
+	for _, uid := range data.AllUIDs() {
+		if pageAfter(uid, after, newestFirst) {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+
+	more := len(uids) > size
+	if more {
+		if newestFirst {
+			uids = uids[len(uids)-size:]
+		} else {
+			uids = uids[:size]
+		}
+	}
+	return uids, more, nil
+}
+
+// pageAfter 邮件是否按排序方向位于游标之后，after为0表示第一页
+func pageAfter(uid, after imap.UID, newestFirst bool) bool {
+	if after == 0 {
+		return true
+	}
+	if newestFirst {
+		return uid < after
+	}
+	return uid > after
+}
+
+// ListPage 按UIDL分页读取邮件，服务器需要支持UIDL命令
+// 游标中记录了本页最后一封邮件的UIDL，该邮件被删除后游标失效
+// 参数:
+//   - cursor: 上一页返回的NextCursor，为空表示第一页
+//   - options: 分页设置，nil表示使用默认设置
+//
+// 返回:
+//   - *Page: 一页邮件
+//   - error: 游标无效时返回ErrInvalidCursor，或获取过程中的错误
+func (c *POP3Client) ListPage(cursor string, options *PageOptions) (*Page, error) {
+	if options == nil {
+		options = &PageOptions{}
+	}
+
+	ids, err := c.conn.Uidl(0)
+	if err != nil {
+		return nil, fmt.Errorf("list unique ids: %w", err)
+	}
+	page := &Page{Total: len(ids)}
+	newestFirst := options.Order == NewestFirst
+
+	// 游标之后的邮件
+	candidates := ids
+	if cursor != "" {
+		fields, err := decodeCursor(cursor, "pop3", 1)
+		if err != nil {
+			return nil, err
+		}
+		pos := -1
+		for i, id := range ids {
+			if id.UID == fields[0] {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			return nil, ErrInvalidCursor
+		}
+		if newestFirst {
+			candidates = ids[:pos]
+		} else {
+			candidates = ids[pos+1:]
+		}
+	}
+
+	size := options.size()
+	more := len(candidates) > size
+	if more {
+		if newestFirst {
+			candidates = candidates[len(candidates)-size:]
+		} else {
+			candidates = candidates[:size]
+		}
+	}
+	if len(candidates) == 0 {
+		return page, nil
+	}
+
+	keepRaw := options.fetch().KeepRaw
+	for i := range candidates {
+		id := candidates[i]
+		if newestFirst {
+			id = candidates[len(candidates)-1-i]
+		}
+		parsedMsg, err := c.retrieve(id.ID, keepRaw)
+		if err != nil {
+			for _, msg := range page.Messages {
+				msg.CloseAttachments()
+			}
+			return nil, fmt.Errorf("retrieve message %d: %w", id.ID, err)
+		}
+		page.Messages = append(page.Messages, parsedMsg)
+	}
+
+	if more {
+		last := candidates[len(candidates)-1]
+		if newestFirst {
+			last = candidates[0]
+		}
+		page.NextCursor = encodeCursor("pop3", last.UID)
+	}
+	return page, nil
+}
@@ -0,0 +1,123 @@
+package email
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestImapListPage(t *testing.T) {
+	for name, caps := range map[string]imap.CapSet{
+		"esearch": {imap.CapIMAP4rev1: {}, imap.CapESearch: {}},
+		"search":  {imap.CapIMAP4rev1: {}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := dialTestServer(t, startTestServer(t, caps))
+			for i := 1; i <= 7; i++ {
+				if _, err := c.Append("INBOX", strings.NewReader(testMessage(fmt.Sprintf("m%d", i))), nil, time.Time{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, tt := range []struct {
+				order PageOrder
+				want  string
+			}{
+				{NewestFirst, "m7 m6 m5|m4 m3 m2|m1"},
+				{OldestFirst, "m1 m2 m3|m4 m5 m6|m7"},
+			} {
+				if got := listAllPages(t, c, &PageOptions{Size: 3, Order: tt.order}); got != tt.want {
+					t.Errorf("order %d: got %q, want %q", tt.order, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// 翻页之间删除邮件，不应重复或遗漏其余的邮件
+func TestImapListPageAfterExpunge(t *testing.T) {
+	port := startTestServer(t, nil)
+	c := dialTestServer(t, port)
+	var uids []imap.UID
+	for i := 1; i <= 6; i++ {
+		uid, err := c.Append("INBOX", strings.NewReader(testMessage(fmt.Sprintf("m%d", i))), nil, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+
+	options := &PageOptions{Size: 2, Order: OldestFirst}
+	first, err := c.ListPage("", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteTestMessages(t, port, uids[0], uids[3])
+
+	got := pageSubjects(first)
+	p := NewPaginator(c, options, first.NextCursor)
+	for p.HasNext() {
+		page, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += "|" + pageSubjects(page)
+	}
+	if want := "m1 m2|m3 m5|m6"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// deleteTestMessages 通过另一个连接删除邮件
+func deleteTestMessages(t *testing.T, port int, uids ...imap.UID) {
+	t.Helper()
+
+	other := dialTestServer(t, port)
+	err := other.withConn(func() error {
+		if _, err := other.selectMailbox("INBOX", nil); err != nil {
+			return err
+		}
+		set := imap.UIDSetNum(uids...)
+		if err := other.client.Store(set, &imap.StoreFlags{
+			Op:     imap.StoreFlagsAdd,
+			Silent: true,
+			Flags:  []imap.Flag{imap.FlagDeleted},
+		}, nil).Close(); err != nil {
+			return err
+		}
+		return other.client.Expunge().Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listAllPages 读取全部页，返回以"|"分隔的每页邮件主题
+func listAllPages(t *testing.T, reader PageReader, options *PageOptions) string {
+	t.Helper()
+
+	var pages []string
+	p := NewPaginator(reader, options)
+	for p.HasNext() {
+		page, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Messages) > 0 {
+			pages = append(pages, pageSubjects(page))
+		}
+	}
+	return strings.Join(pages, "|")
+}
+
+// pageSubjects 返回以空格分隔的本页邮件主题
+func pageSubjects(page *Page) string {
+	subjects := make([]string, len(page.Messages))
+	for i, msg := range page.Messages {
+		subjects[i] = msg.Subject
+	}
+	return strings.Join(subjects, " ")
+}
@@ -0,0 +1,437 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	// defaultPoolConns 未知服务商的默认最大连接数
+	defaultPoolConns = 4
+	// defaultPoolChunkSize 每个连接一次获取的默认邮件数量
+	defaultPoolChunkSize = 200
+)
+
+// providerMaxConns 常见服务商允许单个账号同时建立的IMAP连接数（保守值）
+var (
+	providerMaxConnsMu sync.RWMutex
+	providerMaxConns   = map[string]int{
+		"imap.gmail.com":        10,
+		"outlook.office365.com": 8,
+		"imap.mail.yahoo.com":   5,
+		"imap.mail.me.com":      5,
+		"imap.qq.com":           5,
+		"imap.exmail.qq.com":    5,
+		"imap.163.com":          5,
+		"imap.126.com":          5,
+	}
+)
+
+// ProviderMaxConns 返回服务器允许单个账号同时建立的IMAP连接数，未知服务器返回默认值4
+func ProviderMaxConns(host string) int {
+	providerMaxConnsMu.RLock()
+	defer providerMaxConnsMu.RUnlock()
+
+	if n, ok := providerMaxConns[strings.ToLower(host)]; ok {
+		return n
+	}
+	return defaultPoolConns
+}
+
+// SetProviderMaxConns 设置服务器允许单个账号同时建立的IMAP连接数，影响之后创建的连接池
+func SetProviderMaxConns(host string, n int) {
+	providerMaxConnsMu.Lock()
+	defer providerMaxConnsMu.Unlock()
+	providerMaxConns[strings.ToLower(host)] = n
+}
+
+// PoolOptions 连接池选项
+type PoolOptions struct {
+	MaxConns  int // 最多同时建立的连接数，默认由ProviderMaxConns决定
+	ChunkSize int // 每个连接一次获取的邮件数量，默认200
+	Buffer    int // 已获取但尚未被读取的邮件批次数上限，达到上限时暂停获取，默认为连接数的2倍
+}
+
+// PoolResult 连接池获取的一封邮件或一个错误
+type PoolResult struct {
+	Message *ParsedMessage
+	Err     error // 出错时通道随后会被关闭
+}
+
+// ImapPool 同一账号的IMAP连接池，用于并行下载大量邮件
+// 连接在需要时才建立，使用完毕后放回池中复用；可以被多个goroutine同时使用
+type ImapPool struct {
+	login   LoginParams
+	options PoolOptions
+
+	idle  chan *ImapClient // 空闲的连接
+	slots chan struct{}    // 已建立的连接数
+
+	mu     sync.Mutex // 保护closed以及Put与Close对idle的操作，避免连接在关闭时被放回后泄漏
+	closed bool
+}
+
+// NewImapPool 创建IMAP连接池，会立即建立一个连接以验证登录参数
+// 参数:
+//   - data: 登录参数，协议必须为IMAP
+//   - options: 连接池选项，可为nil
+//
+// 返回:
+//   - *ImapPool: 连接池
+//   - error: 登录失败等错误
+func NewImapPool(data LoginParams, options *PoolOptions) (*ImapPool, error) {
+	if data.Proto != IMAP {
+		return nil, fmt.Errorf("connection pool only supports IMAP")
+	}
+
+	var opts PoolOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = ProviderMaxConns(data.Host)
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultPoolChunkSize
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = opts.MaxConns * 2
+	}
+
+	p := &ImapPool{
+		login:   data,
+		options: opts,
+		idle:    make(chan *ImapClient, opts.MaxConns),
+		slots:   make(chan struct{}, opts.MaxConns),
+	}
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	p.Put(c)
+
+	return p, nil
+}
+
+// Get 从池中取出一个连接，没有空闲连接且未达到上限时建立新连接，否则等待
+// 使用完毕后必须通过Put放回
+func (p *ImapPool) Get(ctx context.Context) (*ImapClient, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, net.ErrClosed
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	case p.slots <- struct{}{}:
+		reader, err := createIMAPClient(p.login)
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return reader.(*ImapClient), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Put 将连接放回池中，连接池已关闭时直接关闭连接
+func (p *ImapPool) Put(c *ImapClient) {
+	p.mu.Lock()
+	if !p.closed {
+		// 连接数不超过idle的容量，不会阻塞
+		p.idle <- c
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	c.Close()
+	<-p.slots
+}
+
+// Close 关闭连接池中的空闲连接，正在使用的连接会在放回时关闭
+func (p *ImapPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+
+	var firstErr error
+	for {
+		select {
+		case c := <-p.idle:
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			<-p.slots
+		default:
+			return firstErr
+		}
+	}
+}
+
+// Fetch 使用多个连接并行获取邮件的完整内容，结果按UID从小到大依次发送到通道
+// UID被切分为若干批次分配给各个连接；调用方读取较慢时获取会暂停，不会占用过多内存。
+// ctx被取消或出错后停止获取并关闭通道，出错时会先发送一个带Err的结果
+// 参数:
+//   - ctx: 用于取消获取的上下文
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uids: 要获取的邮件UID，为nil时获取邮箱中的全部邮件
+//
+// 返回:
+//   - <-chan *PoolResult: 结果通道
+//   - error: 选择邮箱或查询UID时的错误
+func (p *ImapPool) Fetch(ctx context.Context, mailbox string, uids imap.UIDSet) (<-chan *PoolResult, error) {
+	return p.fetch(ctx, mailbox, uids, fullFetchOptions())
+}
+
+// FetchHeaders 与Fetch相同，但只获取邮件的摘要信息和MIME结构，不下载正文
+// 附件在调用Attachment.Open时通过池中的连接下载，因此连接池关闭后无法再读取附件
+func (p *ImapPool) FetchHeaders(ctx context.Context, mailbox string, uids imap.UIDSet) (<-chan *PoolResult, error) {
+	return p.fetch(ctx, mailbox, uids, headersFetchOptions())
+}
+
+// FetchAll 并行获取邮件并收集为列表，参数与Fetch相同
+func (p *ImapPool) FetchAll(ctx context.Context, mailbox string, uids imap.UIDSet) ([]*ParsedMessage, error) {
+	results, err := p.Fetch(ctx, mailbox, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*ParsedMessage
+	for r := range results {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		messages = append(messages, r.Message)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// poolChunk 分配给一个连接的一批邮件
+type poolChunk struct {
+	uids   []imap.UID
+	result chan poolChunkResult
+}
+
+type poolChunkResult struct {
+	messages []*ParsedMessage
+	err      error
+}
+
+func (p *ImapPool) fetch(ctx context.Context, mailbox string, uidSet imap.UIDSet, options *imap.FetchOptions) (<-chan *PoolResult, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	uids, err := p.resolveUIDs(ctx, mailbox, uidSet)
+	if err != nil {
+		return nil, err
+	}
+
+	// 切分批次
+	var chunks []*poolChunk
+	for start := 0; start < len(uids); start += p.options.ChunkSize {
+		end := start + p.options.ChunkSize
+		if end > len(uids) {
+			end = len(uids)
+		}
+		chunks = append(chunks, &poolChunk{
+			uids:   uids[start:end],
+			result: make(chan poolChunkResult, 1),
+		})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan *PoolResult)
+	jobs := make(chan *poolChunk)
+	window := make(chan struct{}, p.options.Buffer) // 已分配但尚未发送完的批次
+
+	// 按顺序分配批次，窗口已满时等待
+	go func() {
+		defer close(jobs)
+		for _, chunk := range chunks {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := p.options.MaxConns
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	for i := 0; i < workers; i++ {
+		go p.fetchWorker(ctx, mailbox, options, jobs)
+	}
+
+	// 按批次顺序合并结果
+	go func() {
+		defer close(results)
+		defer cancel()
+
+		for _, chunk := range chunks {
+			var r poolChunkResult
+			select {
+			case r = <-chunk.result:
+			case <-ctx.Done():
+				return
+			}
+			if r.err != nil {
+				select {
+				case results <- &PoolResult{Err: r.err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, msg := range r.messages {
+				select {
+				case results <- &PoolResult{Message: msg}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			<-window
+		}
+	}()
+
+	return results, nil
+}
+
+// fetchWorker 取出一个连接，依次处理分配到的批次
+func (p *ImapPool) fetchWorker(ctx context.Context, mailbox string, options *imap.FetchOptions, jobs <-chan *poolChunk) {
+	var c *ImapClient
+	defer func() {
+		if c != nil {
+			p.Put(c)
+		}
+	}()
+
+	for chunk := range jobs {
+		if c == nil {
+			var err error
+			c, err = p.Get(ctx)
+			if err != nil {
+				chunk.result <- poolChunkResult{err: err}
+				return
+			}
+		}
+
+		messages, err := c.fetchUIDs(mailbox, chunk.uids, options)
+		chunk.result <- poolChunkResult{messages: messages, err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// resolveUIDs 查询邮箱中实际存在的UID
+func (p *ImapPool) resolveUIDs(ctx context.Context, mailbox string, uidSet imap.UIDSet) ([]imap.UID, error) {
+	c, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Put(c)
+
+	if uidSet == nil {
+		uidSet = imap.UIDSet{{Start: 1, Stop: 0}} // 1:*
+	}
+
+	var found imap.UIDSet
+	err = c.withConn(func() error {
+		selected, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		if selected.NumMessages == 0 {
+			found = nil
+			return nil
+		}
+		found, err = c.searchUIDs(uidSet)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids, _ := found.Nums()
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// fetchUIDs 获取一批邮件并按UID排序
+func (c *ImapClient) fetchUIDs(mailbox string, uids []imap.UID, options *imap.FetchOptions) ([]*ParsedMessage, error) {
+	var messages []*ParsedMessage
+	err := c.withConn(func() error {
+		messages = nil
+		if _, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+			return err
+		}
+
+		cmd := c.client.Fetch(imap.UIDSetNum(uids...), options)
+		defer cmd.Close()
+		for data := cmd.Next(); data != nil; data = cmd.Next() {
+			msg, err := c.parseMessage(data, false)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+		}
+		if err := cmd.Close(); err != nil {
+			return err
+		}
+		c.fillGmailInfo(mailbox, messages)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options.BodyStructure != nil {
+		for _, msg := range messages {
+			msg.Attachments = c.lazyAttachments(mailbox, msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].UID < messages[j].UID })
+	return messages, nil
+}
+
+// fullFetchOptions 获取邮件完整内容的FETCH选项
+func fullFetchOptions() *imap.FetchOptions {
+	return &imap.FetchOptions{
+		Flags:        true,
+		InternalDate: true,
+		RFC822Size:   true,
+		Envelope:     true,
+		UID:          true,
+		BodySection: []*imap.FetchItemBodySection{
+			{Peek: true}, // 获取完整邮件，不标记为已读
+		},
+	}
+}
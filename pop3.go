@@ -1,6 +1,8 @@
 package email
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"mime"
@@ -22,28 +24,47 @@ type POP3Client struct {
 	port   int
 	user   string
 	pwd    string
+	login  *LoginParams // 连接参数，决定加密方式
+	line   *lineConn    // 底层连接，用于以流的方式读取RETR的响应
+
+	attachmentMemLimit int64 // 附件保存在内存中的最大字节数，<=0表示不限制
 }
 
-// 确保POP3Client实现了EmailReader接口
-var _ EmailReader = (*POP3Client)(nil)
+// 确保POP3Client实现了EmailReader和MailboxStatusReader接口
+var (
+	_ EmailReader         = (*POP3Client)(nil)
+	_ MailboxStatusReader = (*POP3Client)(nil)
+)
 
 // NewPOP3Client 创建新的POP3客户端
 func NewPOP3Client(host string, port int, user, pwd string) *POP3Client {
 	return &POP3Client{
-		host: host,
-		port: port,
-		user: user,
-		pwd:  pwd,
+		host:  host,
+		port:  port,
+		user:  user,
+		pwd:   pwd,
+		login: &LoginParams{Host: host, Port: port, User: user, Pwd: pwd, Proto: POP3},
 	}
 }
 
+// SetTLS 设置连接时使用的加密方式和TLS配置，需在Connect之前调用
+// 参数:
+//   - mode: 加密方式，默认根据端口选择（110使用STLS，其余使用隐式TLS）
+//   - config: 自定义TLS配置，nil表示使用系统默认配置
+func (c *POP3Client) SetTLS(mode TLSMode, config *tls.Config) {
+	c.login.TLSMode = mode
+	c.login.TLSConfig = config
+}
+
 // Connect 连接并登录到POP3服务器
 func (c *POP3Client) Connect() error {
 	// 创建POP3客户端
+	// 加密由pop3Dialer处理，以支持自定义TLS配置和STLS
+	dialer := &pop3Dialer{login: c.login}
 	c.client = pop3.New(pop3.Opt{
-		Host:       c.host,
-		Port:       c.port,
-		TLSEnabled: true,
+		Host:   c.host,
+		Port:   c.port,
+		Dialer: dialer,
 	})
 
 	// 创建连接
@@ -52,6 +73,7 @@ func (c *POP3Client) Connect() error {
 		return fmt.Errorf("failed to connect: %v", err)
 	}
 	c.conn = conn
+	c.line = dialer.conn
 
 	// 登录
 	err = c.conn.Auth(c.user, c.pwd)
@@ -72,18 +94,24 @@ func (c *POP3Client) Close() error {
 
 // GetEmail 获取邮件列表
 // 参数:
-//   - opt: 可选参数，支持int类型指定获取邮件数量（默认10封）
+//   - opt: 可选参数，支持int类型指定获取邮件数量（默认10封），
+//     FetchOptions/*FetchOptions指定是否保留原始内容（POP3只支持KeepRaw）
 //
 // 返回:
 //   - []*ParsedMessage: 解析后的邮件列表
 //   - error: 获取过程中的错误
 func (c *POP3Client) GetEmail(opt ...any) ([]*ParsedMessage, error) {
 	var n = 10
+	var keepRaw bool
 	// 处理传入的参数
 	for _, v := range opt {
 		switch val := v.(type) {
 		case int:
 			n = val
+		case FetchOptions:
+			keepRaw = val.KeepRaw
+		case *FetchOptions:
+			keepRaw = val != nil && val.KeepRaw
 		}
 	}
 
@@ -107,26 +135,55 @@ func (c *POP3Client) GetEmail(opt ...any) ([]*ParsedMessage, error) {
 
 	// 获取指定范围的邮件
 	for i := start; i <= count; i++ {
-		// 获取邮件内容
-		msgEntity, err := c.conn.Retr(i)
-		if err != nil {
-			log.Debug("Failed to retrieve message %d: %v", i, err)
-			continue
-		}
-
-		// 解析邮件
-		parsedMsg, err := c.parseMessage(msgEntity, i)
+		parsedMsg, err := c.retrieve(i, keepRaw)
 		if err != nil {
-			log.Debug("Failed to parse message %d: %v", i, err)
+			log.Debugf("skip POP3 message: %v", err)
 			continue
 		}
-
 		messages = append(messages, parsedMsg)
 	}
 
 	return messages, nil
 }
 
+// retrieve 下载并解析第n封邮件，keepRaw为true时保留原始内容
+// 邮件内容直接从连接交给MIME解析器，附件按内存阈值写入临时文件，不会整体读入内存
+func (c *POP3Client) retrieve(n int, keepRaw bool) (*ParsedMessage, error) {
+	// 获取邮件内容
+	r, err := c.retr(n)
+	if err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	if keepRaw {
+		r = io.TeeReader(r, &raw)
+	}
+
+	var parsedMsg *ParsedMessage
+	msgEntity, err := message.Read(r)
+	if err != nil && !message.IsUnknownCharset(err) {
+		err = fmt.Errorf("read message %d: %w", n, err)
+	} else if parsedMsg, err = c.parseMessage(msgEntity, n); err != nil {
+		err = fmt.Errorf("parse message %d: %w", n, err)
+	}
+
+	// 无论解析是否成功都要读完响应，否则下一条命令会读到剩余的邮件内容
+	if _, drainErr := io.Copy(io.Discard, r); drainErr != nil && err == nil {
+		err = fmt.Errorf("retrieve message %d: %w", n, drainErr)
+	}
+	if err != nil {
+		if parsedMsg != nil {
+			parsedMsg.CloseAttachments()
+		}
+		return nil, err
+	}
+
+	if keepRaw {
+		parsedMsg.Raw = raw.Bytes()
+	}
+	return parsedMsg, nil
+}
+
 // parseMessage 解析邮件内容
 func (c *POP3Client) parseMessage(msg *message.Entity, msgNum int) (*ParsedMessage, error) {
 	header := msg.Header
@@ -153,6 +210,7 @@ func (c *POP3Client) parseMessage(msg *message.Entity, msgNum int) (*ParsedMessa
 		InternalDate: time.Now(),    // POP3不提供接收时间，使用当前时间
 		Flags:        []imap.Flag{}, // POP3不支持标志
 	}
+	parseThreadHeaders(parsedMsg, &mail.Header{Header: header})
 
 	// 解析发件人
 	fromHeader := header.Get("From")
@@ -193,6 +251,7 @@ func (c *POP3Client) parseMessage(msg *message.Entity, msgNum int) (*ParsedMessa
 	} else {
 		parsedMsg.TextBody = body
 	}
+	parsedMsg.Snippet = makeSnippet(parsedMsg.TextBody, parsedMsg.HTMLBody)
 	parsedMsg.Attachments = attachments
 
 	return parsedMsg, nil
@@ -276,17 +335,18 @@ func (c *POP3Client) parseAttachment(part *message.Entity, contentType string, d
 		filename = "attachment"
 	}
 
-	// 读取附件数据
-	data, err := io.ReadAll(part.Body)
+	// 读取附件数据，超过阈值时写入临时文件
+	return newAttachment(filename, contentType, part.Body, c.attachmentMemLimit)
+}
+
+// GetThreads 获取最近几封邮件并在客户端按JWZ算法归并为会话，参数与GetEmail相同
+// POP3没有服务器端的会话功能，会话只包含获取到的邮件
+func (c *POP3Client) GetThreads(opt ...any) ([]*Thread, error) {
+	messages, err := c.GetEmail(opt...)
 	if err != nil {
 		return nil, err
 	}
-
-	return &Attachment{
-		Filename:    filename,
-		ContentType: contentType,
-		Data:        data,
-	}, nil
+	return BuildThreads(messages), nil
 }
 
 // ListMailboxes 列出邮箱（POP3不支持邮箱概念，返回空列表）
@@ -295,6 +355,17 @@ func (c *POP3Client) ListMailboxes() ([]string, error) {
 	return []string{"INBOX"}, nil
 }
 
+// SetAttachmentMemLimit 设置附件保存在内存中的最大字节数
+// 超过该大小的附件会写入临时文件，需通过Attachment.Open读取；n<=0表示不限制
+func (c *POP3Client) SetAttachmentMemLimit(n int64) {
+	c.attachmentMemLimit = n
+}
+
+// ListMailboxInfo 列出邮箱详细信息（POP3只有收件箱）
+func (c *POP3Client) ListMailboxInfo() ([]*MailboxInfo, error) {
+	return []*MailboxInfo{{Name: "INBOX", Role: MailboxRoleInbox}}, nil
+}
+
 // MonitEmail 监控新邮件（POP3不支持推送，使用轮询方式）
 func (c *POP3Client) MonitEmail(opt ...any) ([]*ParsedMessage, error) {
 	// POP3不支持实时监控，直接调用GetEmail获取邮件
@@ -317,7 +388,7 @@ func (c *POP3Client) GetEmailByRange(start, end int, mailbox string) ([]*ParsedM
 // GetMailboxStatus 获取邮箱状态信息（POP3 支持）
 func (c *POP3Client) GetMailboxStatus(mailbox string) (*MailboxStatus, error) {
 	// 获取邮件数量
-	count, _, err := c.conn.Stat()
+	count, size, err := c.conn.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("get mailbox status: %w", err)
 	}
@@ -325,6 +396,7 @@ func (c *POP3Client) GetMailboxStatus(mailbox string) (*MailboxStatus, error) {
 	return &MailboxStatus{
 		Name:          "INBOX", // POP3 只有收件箱
 		TotalMessages: int(count),
+		Size:          int64(size),
 		UIDNext:       0, // POP3 不支持 UID
 		UIDValidity:   0, // POP3 不支持 UID 有效性
 	}, nil
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// Quota 一个配额根的使用情况(RFC 9208)
+// 一个配额根可以限制多个邮箱，例如整个账号共用一个存储配额
+type Quota struct {
+	Root      string                                 // 配额根名称，通常为""或"User quota"
+	Resources map[imap.QuotaResourceType]*QuotaUsage // 各类资源的用量，如imap.QuotaResourceStorage
+}
+
+// QuotaUsage 一种资源的用量和上限
+// STORAGE的单位为KiB，MESSAGE和MAILBOX的单位为个
+type QuotaUsage struct {
+	Usage int64 // 已使用
+	Limit int64 // 上限
+}
+
+// Percent 已使用的百分比，上限为0时返回0
+func (u *QuotaUsage) Percent() float64 {
+	if u.Limit <= 0 {
+		return 0
+	}
+	return float64(u.Usage) * 100 / float64(u.Limit)
+}
+
+// Storage 存储空间的用量，服务器未限制存储空间时返回nil
+func (q *Quota) Storage() *QuotaUsage {
+	return q.Resources[imap.QuotaResourceStorage]
+}
+
+// GetQuotaRoot 获取限制指定邮箱的所有配额根及其用量(GETQUOTAROOT)
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//
+// 返回:
+//   - []*Quota: 配额列表，按配额根名称排序；邮箱不受配额限制时为空
+//   - error: 服务器不支持QUOTA扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetQuotaRoot(mailbox string) ([]*Quota, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	var quotas []*Quota
+	err := c.withConn(func() error {
+		if err := c.requireCap(imap.CapQuota); err != nil {
+			return err
+		}
+		data, err := c.client.GetQuotaRoot(mailbox).Wait()
+		if err != nil {
+			return err
+		}
+
+		quotas = make([]*Quota, 0, len(data))
+		for i := range data {
+			quotas = append(quotas, newQuota(&data[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Root < quotas[j].Root })
+	return quotas, nil
+}
+
+// GetQuota 获取指定配额根的用量(GETQUOTA)
+// 参数:
+//   - root: 配额根名称，可通过GetQuotaRoot获得
+//
+// 返回:
+//   - *Quota: 配额用量
+//   - error: 服务器不支持QUOTA扩展时返回包装了ErrNotSupported的错误
+func (c *ImapClient) GetQuota(root string) (*Quota, error) {
+	var quota *Quota
+	err := c.withConn(func() error {
+		if err := c.requireCap(imap.CapQuota); err != nil {
+			return err
+		}
+		data, err := c.client.GetQuota(root).Wait()
+		if err != nil {
+			return err
+		}
+		quota = newQuota(data)
+		return nil
+	})
+	return quota, err
+}
+
+// newQuota 转换QUOTA响应
+func newQuota(data *imapclient.QuotaData) *Quota {
+	quota := &Quota{
+		Root:      data.Root,
+		Resources: make(map[imap.QuotaResourceType]*QuotaUsage, len(data.Resources)),
+	}
+	for typ, res := range data.Resources {
+		quota.Resources[typ] = &QuotaUsage{Usage: res.Usage, Limit: res.Limit}
+	}
+	return quota
+}
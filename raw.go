@@ -0,0 +1,110 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// rawSection 完整的邮件原始内容，使用BODY.PEEK[]不会将邮件标记为已读
+var rawSection = &imap.FetchItemBodySection{Peek: true}
+
+// GetRaw 获取邮件未经解码的原始内容(RFC 5322)，可用于取证、重新投递和归档
+// 参数:
+//   - uid: 邮件UID
+//   - opt: [可选] string类型的邮箱名称，默认为"INBOX"
+//
+// 返回:
+//   - io.Reader: 邮件的原始内容，与服务器保存的字节完全相同
+//   - error: 邮件不存在或获取过程中的错误
+func (c *ImapClient) GetRaw(uid imap.UID, opt ...any) (io.Reader, error) {
+	var mailbox = "INBOX"
+	for _, v := range opt {
+		switch val := v.(type) {
+		case string:
+			mailbox = val
+		}
+	}
+
+	var data []byte
+	err := c.withConn(func() (err error) {
+		data, err = c.getRaw(uid, mailbox)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// getRaw GetRaw的实现
+func (c *ImapClient) getRaw(uid imap.UID, mailbox string) ([]byte, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	// 选择邮箱
+	_, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := c.client.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{rawSection},
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+	for _, buf := range msgs {
+		if buf.UID != uid {
+			continue
+		}
+		if data := buf.FindBodySection(rawSection); data != nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("message uid %d not found", uid)
+}
+
+// GetRaw 获取邮件未经解码的原始内容(RFC 5322)，可用于取证、重新投递和归档
+// 参数:
+//   - n: 邮件序号，从1开始
+//
+// 返回:
+//   - io.Reader: 邮件的原始内容，已去除POP3传输时添加的点填充
+//   - error: 获取过程中的错误
+func (c *POP3Client) GetRaw(n int) (io.Reader, error) {
+	data, err := c.retrRaw(n)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// retrRaw 使用RETR下载邮件的原始内容
+func (c *POP3Client) retrRaw(n int) ([]byte, error) {
+	r, err := c.retr(n)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve message %d: %w", n, err)
+	}
+	return data, nil
+}
+
+// retr 发送RETR命令，返回读取邮件原始内容的Reader，已去除点填充
+// 调用方必须在发送下一条命令之前读完返回的Reader
+func (c *POP3Client) retr(n int) (io.Reader, error) {
+	if err := c.conn.Send(fmt.Sprintf("RETR %d", n)); err != nil {
+		return nil, fmt.Errorf("retrieve message %d: %w", n, err)
+	}
+	if _, err := c.conn.ReadOne(); err != nil {
+		return nil, fmt.Errorf("retrieve message %d: %w", n, err)
+	}
+	return &dotReader{r: c.line.r}, nil
+}
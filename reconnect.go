@@ -0,0 +1,217 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/go-enols/go-log"
+)
+
+// ReconnectPolicy 断线重连策略
+type ReconnectPolicy struct {
+	MaxAttempts int           // 每次断线最多尝试重连的次数，0表示使用默认值5，<0表示不自动重连
+	MinBackoff  time.Duration // 第一次重试前的等待时间，默认1秒，之后每次翻倍
+	MaxBackoff  time.Duration // 两次重试之间等待时间的上限，默认1分钟
+}
+
+// defaultReconnectPolicy 默认重连策略
+var defaultReconnectPolicy = ReconnectPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  time.Second,
+	MaxBackoff:  time.Minute,
+}
+
+// withDefaults 返回填充了默认值的策略
+func (p *ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p == nil {
+		return defaultReconnectPolicy
+	}
+	policy := *p
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultReconnectPolicy.MaxAttempts
+	}
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = defaultReconnectPolicy.MinBackoff
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = defaultReconnectPolicy.MaxBackoff
+		if policy.MaxBackoff < policy.MinBackoff {
+			policy.MaxBackoff = policy.MinBackoff
+		}
+	}
+	return policy
+}
+
+// newImapClient 根据登录参数创建未连接的IMAP客户端
+func newImapClient(data LoginParams) *ImapClient {
+	return &ImapClient{
+		login:              &data,
+		unilateral:         newUnilateralQueue(),
+		wake:               make(chan struct{}, 1),
+		acquired:           make(chan struct{}, 1),
+		attachmentMemLimit: data.AttachmentMemLimit,
+	}
+}
+
+// connect 连接服务器并登录
+// OAuth2账号每次连接都会重新获取访问令牌，因此重连时令牌不会过期
+func (c *ImapClient) connect() (*imapclient.Client, error) {
+	var client *imapclient.Client
+	var err error
+	if c.login.DisableCompress {
+		client, err = c.connectPlain()
+	} else {
+		client, err = c.connectCompressed()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.sendID(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// connectPlain 连接服务器并登录，不启用压缩
+func (c *ImapClient) connectPlain() (*imapclient.Client, error) {
+	data := c.login
+	client, err := dialIMAP(c)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := data.oauth2Authenticator()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if auth != nil {
+		err = client.Authenticate(auth)
+	} else {
+		err = client.Login(data.User, data.Pwd).Wait()
+	}
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// oauth2Authenticator 设置了ClientId和RefreshToken的账号获取访问令牌并返回XOAUTH2认证器，
+// 其他账号返回nil，使用密码登录
+func (data *LoginParams) oauth2Authenticator() (*XOAUTH2Authenticator, error) {
+	if data.ClientId == "" || data.RefreshToken == "" {
+		return nil, nil
+	}
+
+	token, err := getAccessTokenFromRefreshToken(data.httpClient(), data.RefreshToken, data.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if token["code"].(int) != 0 {
+		return nil, fmt.Errorf("oauth2: %v", token["message"])
+	}
+	return &XOAUTH2Authenticator{
+		Username:    data.User,
+		AccessToken: token["access_token"].(string),
+	}, nil
+}
+
+// Reconnect 断开当前连接并重新连接、登录，然后重新选择之前选中的邮箱
+// 按重连策略进行多次重试，两次重试之间的等待时间指数增长。
+// 通常不需要手动调用：连接断开或服务器发送BYE后，下一次调用会自动重连
+// 返回:
+//   - error: 所有重试都失败时返回最后一次的错误
+func (c *ImapClient) Reconnect() error {
+	c.lock()
+	defer c.unlock()
+	return c.reconnect(context.Background())
+}
+
+// reconnect 按重连策略重新建立连接，ctx被取消时停止重试
+// 调用方必须持有会话锁
+func (c *ImapClient) reconnect(ctx context.Context) error {
+	if c.closed.Load() {
+		return net.ErrClosed
+	}
+	if c.login == nil {
+		return fmt.Errorf("client was not created with AutoLogin or ImapConnect")
+	}
+
+	policy := c.login.Reconnect.withDefaults()
+	attempts := policy.MaxAttempts
+	if attempts < 0 {
+		attempts = 1
+	}
+
+	if c.client != nil {
+		c.client.Close()
+	}
+	c.selected = nil
+
+	backoff := policy.MinBackoff
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			backoff *= 2
+			if backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+
+		client, err := c.connect()
+		if err != nil {
+			lastErr = err
+			log.Debugf("reconnect attempt %d to %s failed: %v", i+1, c.login.Host, err)
+			continue
+		}
+		if !c.setClient(client) {
+			return net.ErrClosed
+		}
+
+		// 恢复之前选中的邮箱
+		if c.mailbox != "" {
+			if _, err := c.selectMailbox(c.mailbox, c.selectOptions); err != nil {
+				c.mailbox = ""
+				log.Debugf("reselect mailbox after reconnect failed: %v", err)
+			}
+		}
+		log.Debugf("reconnected to %s", c.login.Host)
+		return nil
+	}
+	return fmt.Errorf("reconnect to %s failed after %d attempts: %w", c.login.Host, attempts, lastErr)
+}
+
+// broken 判断连接是否已断开
+// 服务器发送BYE后会关闭连接，此时客户端状态变为Logout
+func (c *ImapClient) broken(err error) bool {
+	if c.client == nil || c.client.State() == imap.ConnStateLogout {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr)
+}
+
+// autoReconnect 是否允许自动重连
+func (c *ImapClient) autoReconnect() bool {
+	return c.login != nil && !c.closed.Load() && (c.login.Reconnect == nil || c.login.Reconnect.MaxAttempts >= 0)
+}
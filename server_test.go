@@ -0,0 +1,70 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// startTestServer 启动进程内的IMAP服务器，用户名为"user"，密码为"pass"，返回监听端口
+func startTestServer(t *testing.T, caps imap.CapSet, mailboxes ...string) int {
+	t.Helper()
+
+	user := imapmemserver.NewUser("user", "pass")
+	for _, name := range append([]string{"INBOX"}, mailboxes...) {
+		if err := user.Create(name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem := imapmemserver.New()
+	mem.AddUser(user)
+
+	if caps == nil {
+		caps = imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIdle: {}, imap.CapESearch: {}}
+	}
+	srv := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return mem.NewSession(), nil, nil
+		},
+		Caps:         caps,
+		InsecureAuth: true,
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// dialTestServer 登录startTestServer启动的服务器
+func dialTestServer(t *testing.T, port int) *ImapClient {
+	t.Helper()
+
+	client, err := AutoLoginReader(LoginParams{
+		Host:    "127.0.0.1",
+		Port:    port,
+		User:    "user",
+		Pwd:     "pass",
+		Proto:   IMAP,
+		TLSMode: TLSNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.(*ImapClient)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// testMessage 返回一封简单的纯文本邮件
+func testMessage(subject string) string {
+	return fmt.Sprintf("From: sender@example.com\r\nTo: user@example.com\r\nSubject: %s\r\n"+
+		"Message-ID: <%s@example.com>\r\nContent-Type: text/plain\r\n\r\nbody of %s\r\n", subject, subject, subject)
+}
@@ -0,0 +1,139 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/go-enols/go-log"
+)
+
+// ErrNotSupported 服务器不支持所需的扩展，可用errors.Is判断
+var ErrNotSupported = errors.New("not supported by server")
+
+// requireCap 服务器不支持cap时返回包装了ErrNotSupported的错误，调用方必须持有会话锁
+func (c *ImapClient) requireCap(cap imap.Cap) error {
+	if !c.client.Caps().Has(cap) {
+		return fmt.Errorf("%s: %w", cap, ErrNotSupported)
+	}
+	return nil
+}
+
+// lock 获取会话锁
+// 如果Watch正在IDLE，会先通知它结束IDLE并让出会话锁
+func (c *ImapClient) lock() {
+	c.waiting.Add(1)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	c.mu.Lock()
+	if c.waiting.Add(-1) == 0 {
+		select {
+		case c.acquired <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// unlock 释放会话锁
+func (c *ImapClient) unlock() {
+	c.mu.Unlock()
+}
+
+// setClient 替换底层连接，客户端已被关闭时关闭新连接并返回false
+func (c *ImapClient) setClient(client *imapclient.Client) bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.closed.Load() {
+		client.Close()
+		return false
+	}
+	c.client = client
+	return true
+}
+
+// ensureConn 连接已断开时先重连，调用方必须持有会话锁
+func (c *ImapClient) ensureConn() error {
+	if c.closed.Load() {
+		return net.ErrClosed
+	}
+	if c.autoReconnect() && c.broken(nil) {
+		return c.reconnect(context.Background())
+	}
+	return nil
+}
+
+// withConn 持有会话锁执行一组IMAP命令，连接断开导致失败时重连并重新执行一次
+// fn必须可以安全地重复执行，不幂等的命令（如APPEND）应持有会话锁后只使用ensureConn
+func (c *ImapClient) withConn(fn func() error) error {
+	c.lock()
+	defer c.unlock()
+
+	if err := c.ensureConn(); err != nil {
+		return err
+	}
+
+	err := fn()
+	if err == nil || !c.autoReconnect() || !c.broken(err) {
+		return err
+	}
+
+	log.Debugf("connection to %s lost: %v", c.login.Host, err)
+	if rerr := c.reconnect(context.Background()); rerr != nil {
+		return fmt.Errorf("%w (%v)", err, rerr)
+	}
+	return fn()
+}
+
+// selectMailbox 选择邮箱并记录下来，重连后会重新选择该邮箱，调用方必须持有会话锁
+// 邮箱已经以相同的模式被选中时不再发送SELECT，返回的数据中邮件数量为最新值。
+// 需要CONDSTORE的选择总是重新发送，以获取最新的HIGHESTMODSEQ
+func (c *ImapClient) selectMailbox(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	if c.isSelected(mailbox, options) {
+		data := *c.selected
+		if current := c.client.Mailbox(); current != nil {
+			data.NumMessages = current.NumMessages
+			data.Flags = current.Flags
+			data.PermanentFlags = current.PermanentFlags
+		}
+		return &data, nil
+	}
+
+	selected, err := c.client.Select(mailbox, options).Wait()
+	if err != nil {
+		c.mailbox = ""
+		c.selected = nil
+		return nil, err
+	}
+	c.mailbox = mailbox
+	c.selectOptions = options
+	c.selected = selected
+	c.selectGen++
+	return selected, nil
+}
+
+// isSelected 邮箱是否已经以相同的模式被选中
+func (c *ImapClient) isSelected(mailbox string, options *imap.SelectOptions) bool {
+	if c.selected == nil || c.mailbox != mailbox {
+		return false
+	}
+	if options != nil && options.CondStore {
+		return false
+	}
+	if readOnly(options) != readOnly(c.selectOptions) {
+		return false
+	}
+
+	current := c.client.Mailbox()
+	return c.client.State() == imap.ConnStateSelected && current != nil && current.Name == mailbox
+}
+
+// readOnly 是否以只读方式(EXAMINE)选择邮箱
+func readOnly(options *imap.SelectOptions) bool {
+	return options != nil && options.ReadOnly
+}
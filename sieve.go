@@ -0,0 +1,618 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSievePort ManageSieve的默认端口(RFC 5804)
+const defaultSievePort = 4190
+
+// SieveClient ManageSieve(RFC 5804)客户端，用于管理服务器端的Sieve过滤脚本
+// 可以被多个goroutine同时使用，命令按顺序执行
+type SieveClient struct {
+	mu    sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	login *LoginParams
+	caps  map[string]string // 服务器能力，键为大写的能力名称
+}
+
+// 确保SieveClient实现了EmailClient接口
+var _ EmailClient = (*SieveClient)(nil)
+
+// SieveScript 服务器上的Sieve脚本
+type SieveScript struct {
+	Name   string // 脚本名称
+	Active bool   // 是否为当前生效的脚本，同一时间最多只有一个
+}
+
+// SieveError ManageSieve服务器以NO或BYE拒绝了命令
+type SieveError struct {
+	Status string // NO或BYE
+	Code   string // 响应码，如NONEXISTENT、ACTIVE、QUOTA/MAXSIZE，可能为空
+	Text   string // 服务器返回的说明；PUTSCRIPT和CHECKSCRIPT失败时为脚本的错误信息
+}
+
+func (e *SieveError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("managesieve: %s (%s) %s", e.Status, e.Code, e.Text)
+	}
+	return fmt.Sprintf("managesieve: %s %s", e.Status, e.Text)
+}
+
+// sieveAtom 响应中的原子，如OK、NO、ACTIVE；命令中原样发送的参数
+type sieveAtom string
+
+// sieveList 响应码中带括号的列表
+type sieveList []any
+
+// sieveResponse 一条命令的完整响应
+type sieveResponse struct {
+	lines [][]any // 状态行之前的数据行
+	code  string  // 响应码，如WARNINGS
+	text  string  // 状态行中的说明
+}
+
+// SieveConnect 连接ManageSieve服务器并登录
+// 可以直接使用IMAP的登录参数：Proto不是SIEVE时改用ManageSieve的默认端口4190，
+// 并将隐式TLS改为STARTTLS。需要OAuth2的账号使用XOAUTH2认证，其他账号使用PLAIN
+// 参数:
+//   - data: 登录参数，Host、User、Pwd、TLSConfig和Dialer与IMAP相同
+//
+// 返回:
+//   - *SieveClient: 已登录的客户端
+//   - error: 连接或认证过程中的错误
+func SieveConnect(data LoginParams) (*SieveClient, error) {
+	if data.Proto != SIEVE {
+		data.Proto = SIEVE
+		data.Port = 0
+		if data.TLSMode == TLSImplicit {
+			data.TLSMode = TLSAuto
+		}
+	}
+	if data.Port == 0 {
+		data.Port = defaultSievePort
+	}
+
+	c := &SieveClient{login: &data}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect 建立连接、按需升级为TLS并认证
+func (c *SieveClient) connect() error {
+	conn, err := dialConn(c.login)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	if err := c.start(); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// start 读取问候中的能力，完成STARTTLS和认证
+func (c *SieveClient) start() error {
+	greeting, err := c.readResponse()
+	if err != nil {
+		return fmt.Errorf("read greeting: %w", err)
+	}
+	c.caps = parseSieveCaps(greeting.lines)
+
+	if c.login.tlsMode() == TLSStartTLS {
+		if _, ok := c.caps["STARTTLS"]; !ok {
+			return fmt.Errorf("managesieve: STARTTLS: %w", ErrNotSupported)
+		}
+		if _, err := c.command(sieveAtom("STARTTLS")); err != nil {
+			return err
+		}
+		tlsConn := tls.Client(c.conn, c.login.tlsConfig())
+		tlsConn.SetDeadline(time.Now().Add(defaultDialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+
+		// 升级后服务器会重新发送能力
+		resp, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		c.caps = parseSieveCaps(resp.lines)
+	}
+
+	var auth saslClient = &plainAuthenticator{Username: c.login.User, Password: c.login.Pwd}
+	if oauth, err := c.login.oauth2Authenticator(); err != nil {
+		return err
+	} else if oauth != nil {
+		auth = oauth
+	}
+	if err := c.authenticate(auth); err != nil {
+		return err
+	}
+
+	// 认证后部分服务器会声明更多的能力
+	resp, err := c.command(sieveAtom("CAPABILITY"))
+	if err != nil {
+		return err
+	}
+	c.caps = parseSieveCaps(resp.lines)
+	return nil
+}
+
+// plainAuthenticator SASL PLAIN认证(RFC 4616)
+type plainAuthenticator struct {
+	Username string
+	Password string
+}
+
+func (a *plainAuthenticator) Start() (mech string, ir []byte, err error) {
+	return "PLAIN", []byte("\x00" + a.Username + "\x00" + a.Password), nil
+}
+
+func (a *plainAuthenticator) Next(challenge []byte) (response []byte, err error) {
+	return nil, fmt.Errorf("unexpected challenge during PLAIN")
+}
+
+// authenticate 使用SASL机制认证，初始响应随AUTHENTICATE命令一起发送
+func (c *SieveClient) authenticate(auth saslClient) error {
+	mech, ir, err := auth.Start()
+	if err != nil {
+		return err
+	}
+	if !c.hasSASL(mech) {
+		return fmt.Errorf("managesieve: SASL %s: %w", mech, ErrNotSupported)
+	}
+
+	args := []any{sieveAtom("AUTHENTICATE"), mech}
+	if ir != nil {
+		args = append(args, base64.StdEncoding.EncodeToString(ir))
+	}
+	if err := c.writeCommand(args...); err != nil {
+		return err
+	}
+
+	for {
+		tokens, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if _, done, err := parseSieveStatus(tokens); done {
+			return err
+		}
+
+		// 服务器的质询是一个字符串
+		var challenge []byte
+		if len(tokens) > 0 {
+			if s, ok := tokens[0].(string); ok {
+				challenge, _ = base64.StdEncoding.DecodeString(s)
+			}
+		}
+		reply, err := auth.Next(challenge)
+		if err != nil {
+			// 取消认证，服务器随后以NO结束命令
+			if err := c.writeCommand("*"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.writeCommand(base64.StdEncoding.EncodeToString(reply)); err != nil {
+			return err
+		}
+	}
+}
+
+// hasSASL 服务器是否支持指定的SASL机制
+func (c *SieveClient) hasSASL(mech string) bool {
+	for _, m := range strings.Fields(c.caps["SASL"]) {
+		if strings.EqualFold(m, mech) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSieveCaps 解析能力列表，每行为能力名称和可选的值
+func parseSieveCaps(lines [][]any) map[string]string {
+	caps := make(map[string]string)
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		name, _ := line[0].(string)
+		var value string
+		if len(line) > 1 {
+			value, _ = line[1].(string)
+		}
+		caps[strings.ToUpper(name)] = value
+	}
+	return caps
+}
+
+// Capabilities 返回服务器声明的能力，如"IMPLEMENTATION"、"SIEVE"、"SASL"、"VERSION"
+// 返回的是副本，修改它不会影响客户端
+func (c *SieveClient) Capabilities() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	caps := make(map[string]string, len(c.caps))
+	for k, v := range c.caps {
+		caps[k] = v
+	}
+	return caps
+}
+
+// HasExtension 服务器是否支持指定的Sieve扩展，如"fileinto"、"vacation"、"copy"
+func (c *SieveClient) HasExtension(ext string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range strings.Fields(c.caps["SIEVE"]) {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListScripts 列出服务器上的全部脚本
+// 返回:
+//   - []SieveScript: 脚本列表，Active表示当前生效的脚本
+//   - error: 获取过程中的错误
+func (c *SieveClient) ListScripts() ([]SieveScript, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, err := c.command(sieveAtom("LISTSCRIPTS"))
+	if err != nil {
+		return nil, err
+	}
+	var scripts []SieveScript
+	for _, line := range resp.lines {
+		if len(line) == 0 {
+			continue
+		}
+		name, ok := line[0].(string)
+		if !ok {
+			continue
+		}
+		script := SieveScript{Name: name}
+		if len(line) > 1 {
+			if atom, ok := line[1].(sieveAtom); ok && strings.EqualFold(string(atom), "ACTIVE") {
+				script.Active = true
+			}
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// GetScript 获取脚本内容
+// 参数:
+//   - name: 脚本名称
+//
+// 返回:
+//   - string: 脚本内容
+//   - error: 脚本不存在时返回Code为NONEXISTENT的*SieveError
+func (c *SieveClient) GetScript(name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, err := c.command(sieveAtom("GETSCRIPT"), name)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range resp.lines {
+		if len(line) > 0 {
+			if script, ok := line[0].(string); ok {
+				return script, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("managesieve: GETSCRIPT %q returned no data", name)
+}
+
+// PutScript 上传脚本，同名脚本会被覆盖；服务器会先检查语法，有错误时拒绝保存
+// 上传不会使脚本生效，需要再调用ActivateScript
+// 参数:
+//   - name: 脚本名称
+//   - script: 脚本内容，可以使用SieveBuilder生成
+//
+// 返回:
+//   - error: 脚本有语法错误时返回*SieveError，Text为错误信息
+func (c *SieveClient) PutScript(name, script string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.command(sieveAtom("PUTSCRIPT"), name, []byte(script))
+	return err
+}
+
+// CheckScript 只检查脚本语法，不保存，需要服务器支持ManageSieve 1.0
+// 参数:
+//   - script: 脚本内容
+//
+// 返回:
+//   - string: 服务器返回的警告，没有警告时为空
+//   - error: 脚本有语法错误时返回*SieveError，Text为错误信息
+func (c *SieveClient) CheckScript(script string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.caps["VERSION"]; !ok {
+		return "", fmt.Errorf("managesieve: CHECKSCRIPT: %w", ErrNotSupported)
+	}
+	resp, err := c.command(sieveAtom("CHECKSCRIPT"), []byte(script))
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(resp.code, "WARNINGS") {
+		return resp.text, nil
+	}
+	return "", nil
+}
+
+// ActivateScript 使指定脚本生效，之前生效的脚本会被停用
+// 参数:
+//   - name: 脚本名称，为空表示停用所有脚本
+//
+// 返回:
+//   - error: 脚本不存在时返回Code为NONEXISTENT的*SieveError
+func (c *SieveClient) ActivateScript(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.command(sieveAtom("SETACTIVE"), name)
+	return err
+}
+
+// DeleteScript 删除脚本，生效中的脚本需要先停用才能删除
+// 参数:
+//   - name: 脚本名称
+//
+// 返回:
+//   - error: 脚本不存在或正在生效时返回*SieveError，Code分别为NONEXISTENT和ACTIVE
+func (c *SieveClient) DeleteScript(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.command(sieveAtom("DELETESCRIPT"), name)
+	return err
+}
+
+// Close 退出登录并关闭连接
+func (c *SieveClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.command(sieveAtom("LOGOUT"))
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// command 发送命令并读取响应，服务器返回NO或BYE时返回*SieveError
+func (c *SieveClient) command(args ...any) (*sieveResponse, error) {
+	if c.conn == nil {
+		return nil, net.ErrClosed
+	}
+	if err := c.writeCommand(args...); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+// writeCommand 发送一行命令
+// string参数以带引号的字符串发送，包含换行或过长时改用字面量；[]byte参数总是以字面量发送
+func (c *SieveClient) writeCommand(args ...any) error {
+	var buf bytes.Buffer
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		switch v := arg.(type) {
+		case sieveAtom:
+			buf.WriteString(string(v))
+		case string:
+			if len(v) > 1024 || strings.ContainsAny(v, "\r\n\x00") {
+				writeSieveLiteral(&buf, []byte(v))
+			} else {
+				buf.WriteString(quoteIMAP(v))
+			}
+		case []byte:
+			writeSieveLiteral(&buf, v)
+		}
+	}
+	buf.WriteString("\r\n")
+
+	c.conn.SetWriteDeadline(time.Now().Add(2 * time.Minute))
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeSieveLiteral 写入非同步字面量，客户端不需要等待服务器的继续请求
+func writeSieveLiteral(buf *bytes.Buffer, data []byte) {
+	fmt.Fprintf(buf, "{%d+}\r\n", len(data))
+	buf.Write(data)
+}
+
+// readResponse 读取数据行直到状态行
+func (c *SieveClient) readResponse() (*sieveResponse, error) {
+	var lines [][]any
+	for {
+		tokens, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if resp, done, err := parseSieveStatus(tokens); done {
+			if resp != nil {
+				resp.lines = lines
+			}
+			return resp, err
+		}
+		lines = append(lines, tokens)
+	}
+}
+
+// parseSieveStatus 判断一行是否为OK、NO或BYE状态行
+// 是状态行时done为true，NO和BYE返回*SieveError
+func parseSieveStatus(tokens []any) (resp *sieveResponse, done bool, err error) {
+	if len(tokens) == 0 {
+		return nil, false, nil
+	}
+	atom, ok := tokens[0].(sieveAtom)
+	if !ok {
+		return nil, false, nil
+	}
+	status := strings.ToUpper(string(atom))
+	if status != "OK" && status != "NO" && status != "BYE" {
+		return nil, false, nil
+	}
+
+	resp = &sieveResponse{}
+	rest := tokens[1:]
+	if len(rest) > 0 {
+		if list, ok := rest[0].(sieveList); ok {
+			if len(list) > 0 {
+				resp.code = fmt.Sprint(list[0])
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 {
+		resp.text, _ = rest[0].(string)
+	}
+
+	if status != "OK" {
+		return resp, true, &SieveError{Status: status, Code: resp.code, Text: resp.text}
+	}
+	return resp, true, nil
+}
+
+// readLine 读取一行响应并解析为原子、字符串和列表，字面量会被读取为字符串
+func (c *SieveClient) readLine() ([]any, error) {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
+
+	var line []any
+	var stack []sieveList
+	add := func(v any) {
+		if len(stack) > 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], v)
+		} else {
+			line = append(line, v)
+		}
+	}
+
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case ' ', '\r':
+		case '\n':
+			if len(stack) > 0 {
+				return nil, fmt.Errorf("managesieve: unbalanced parenthesis in response")
+			}
+			return line, nil
+		case '(':
+			stack = append(stack, sieveList{})
+		case ')':
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("managesieve: unexpected ')' in response")
+			}
+			list := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			add(list)
+		case '"':
+			s, err := c.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			add(s)
+		case '{':
+			s, err := c.readLiteral()
+			if err != nil {
+				return nil, err
+			}
+			add(s)
+		default:
+			atom := []byte{b}
+			for {
+				next, err := c.r.Peek(1)
+				if err != nil {
+					return nil, err
+				}
+				if next[0] == ' ' || next[0] == '(' || next[0] == ')' || next[0] == '\r' || next[0] == '\n' {
+					break
+				}
+				c.r.ReadByte()
+				atom = append(atom, next[0])
+			}
+			add(sieveAtom(atom))
+		}
+	}
+}
+
+// readQuoted 读取带引号的字符串，开头的引号已被读取
+func (c *SieveClient) readQuoted() (string, error) {
+	var sb strings.Builder
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if b, err = c.r.ReadByte(); err != nil {
+				return "", err
+			}
+		case '\n':
+			return "", fmt.Errorf("managesieve: unterminated string in response")
+		}
+		sb.WriteByte(b)
+	}
+}
+
+// readLiteral 读取字面量，开头的"{"已被读取
+func (c *SieveClient) readLiteral() (string, error) {
+	header, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	header = strings.TrimRight(header, "\r\n")
+	if !strings.HasSuffix(header, "}") {
+		return "", fmt.Errorf("managesieve: invalid literal {%s", header)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(header, "}"), "+"))
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("managesieve: invalid literal {%s", header)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
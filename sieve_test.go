@@ -0,0 +1,195 @@
+package email
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sieveReader 返回从data读取响应的SieveClient
+func sieveReader(t *testing.T, data string) *SieveClient {
+	t.Helper()
+
+	conn, other := net.Pipe()
+	t.Cleanup(func() {
+		conn.Close()
+		other.Close()
+	})
+	return &SieveClient{conn: conn, r: bufio.NewReader(strings.NewReader(data))}
+}
+
+func TestSieveReadLine(t *testing.T) {
+	tests := []struct {
+		data string
+		want []any
+	}{
+		{
+			data: `"IMPLEMENTATION" "Dovecot Pigeonhole"` + "\r\n",
+			want: []any{"IMPLEMENTATION", "Dovecot Pigeonhole"},
+		},
+		{
+			data: `"filters" ACTIVE` + "\r\n",
+			want: []any{"filters", sieveAtom("ACTIVE")},
+		},
+		{
+			data: `NO (QUOTA/MAXSIZE) "too \"big\" \\ script"` + "\r\n",
+			want: []any{sieveAtom("NO"), sieveList{sieveAtom("QUOTA/MAXSIZE")}, `too "big" \ script`},
+		},
+		{
+			data: "OK (TAG {3}\r\nabc) \"done\"\r\n",
+			want: []any{sieveAtom("OK"), sieveList{sieveAtom("TAG"), "abc"}, "done"},
+		},
+		{
+			data: "{12+}\r\nrequire x;\r\n\r\n",
+			want: []any{"require x;\r\n"},
+		},
+		{
+			data: "OK (A (B C))\n",
+			want: []any{sieveAtom("OK"), sieveList{sieveAtom("A"), sieveList{sieveAtom("B"), sieveAtom("C")}}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := sieveReader(t, tt.data).readLine()
+		if err != nil {
+			t.Errorf("readLine(%q): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readLine(%q) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestSieveReadLineErrors(t *testing.T) {
+	for _, data := range []string{
+		"OK (A\r\n",
+		"OK A)\r\n",
+		"\"unterminated\r\n",
+		"{x}\r\nabc\r\n",
+		"{10}\r\nshort",
+		"OK",
+	} {
+		if _, err := sieveReader(t, data).readLine(); err == nil {
+			t.Errorf("readLine(%q): expected error", data)
+		}
+	}
+}
+
+func TestSieveReadResponse(t *testing.T) {
+	c := sieveReader(t, "\"a\"\r\n\"b\" ACTIVE\r\nOK \"Listscripts completed.\"\r\n"+
+		"OK (WARNINGS) \"line 2: unused variable\"\r\n"+
+		"NO (NONEXISTENT) \"There is no script by that name\"\r\n"+
+		"BYE \"Server shutting down\"\r\n")
+
+	resp, err := c.readResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]any{{"a"}, {"b", sieveAtom("ACTIVE")}}; !reflect.DeepEqual(resp.lines, want) {
+		t.Errorf("lines = %#v, want %#v", resp.lines, want)
+	}
+	if resp.text != "Listscripts completed." {
+		t.Errorf("text = %q", resp.text)
+	}
+
+	resp, err = c.readResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.code != "WARNINGS" || resp.text != "line 2: unused variable" {
+		t.Errorf("got code %q, text %q", resp.code, resp.text)
+	}
+
+	for _, want := range []SieveError{
+		{Status: "NO", Code: "NONEXISTENT", Text: "There is no script by that name"},
+		{Status: "BYE", Text: "Server shutting down"},
+	} {
+		_, err = c.readResponse()
+		var sieveErr *SieveError
+		if !errors.As(err, &sieveErr) || *sieveErr != want {
+			t.Errorf("got %v, want %v", err, &want)
+		}
+	}
+}
+
+func TestParseSieveCaps(t *testing.T) {
+	c := sieveReader(t, "\"IMPLEMENTATION\" \"Dovecot\"\r\n\"SASL\" \"PLAIN XOAUTH2\"\r\n"+
+		"\"Sieve\" \"fileinto vacation\"\r\n\"STARTTLS\"\r\n\"VERSION\" \"1.0\"\r\nOK \"ready\"\r\n")
+	resp, err := c.readResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.caps = parseSieveCaps(resp.lines)
+
+	if _, ok := c.caps["STARTTLS"]; !ok {
+		t.Error("missing STARTTLS")
+	}
+	if !c.hasSASL("xoauth2") || c.hasSASL("LOGIN") {
+		t.Errorf("SASL = %q", c.caps["SASL"])
+	}
+	if !c.HasExtension("Vacation") || c.HasExtension("copy") {
+		t.Errorf("SIEVE = %q", c.caps["SIEVE"])
+	}
+}
+
+// 命令的参数按类型编码，GETSCRIPT返回的字面量为脚本内容
+func TestSieveCommands(t *testing.T) {
+	script := "require \"fileinto\";\r\nfileinto \"Invoices\";\r\n"
+	commands := make(chan string, 4)
+
+	conn, server := net.Pipe()
+	defer conn.Close()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		for _, reply := range []string{
+			"OK\r\n",
+			"{43}\r\n" + script + "\r\nOK\r\n",
+			"NO (ACTIVE) \"You may not delete an active script\"\r\n",
+		} {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasSuffix(line, "+}\r\n") {
+				// 非同步字面量的内容紧随其后
+				rest := make([]byte, len(script)+2)
+				if _, err := io.ReadFull(r, rest); err != nil {
+					return
+				}
+				line += string(rest)
+			}
+			commands <- line
+			server.Write([]byte(reply))
+		}
+	}()
+	c := &SieveClient{conn: conn, r: bufio.NewReader(conn)}
+
+	if err := c.PutScript("my filters", script); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-commands, "PUTSCRIPT \"my filters\" {43+}\r\n"+script+"\r\n"; got != want {
+		t.Errorf("PUTSCRIPT sent %q, want %q", got, want)
+	}
+
+	got, err := c.GetScript("my filters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != script {
+		t.Errorf("GetScript = %q", got)
+	}
+	if got := <-commands; got != "GETSCRIPT \"my filters\"\r\n" {
+		t.Errorf("GETSCRIPT sent %q", got)
+	}
+
+	err = c.DeleteScript("my filters")
+	var sieveErr *SieveError
+	if !errors.As(err, &sieveErr) || sieveErr.Code != "ACTIVE" {
+		t.Errorf("DeleteScript: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package email
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SieveTest Sieve脚本中的条件，由SieveHeaderContains等函数创建
+type SieveTest string
+
+// SieveHeaderContains 邮件头包含指定内容（忽略大小写），如主题包含"发票"
+func SieveHeaderContains(header, value string) SieveTest {
+	return SieveTest(fmt.Sprintf("header :contains %s %s", quoteSieve(header), quoteSieve(value)))
+}
+
+// SieveHeaderIs 邮件头等于指定内容（忽略大小写）
+func SieveHeaderIs(header, value string) SieveTest {
+	return SieveTest(fmt.Sprintf("header :is %s %s", quoteSieve(header), quoteSieve(value)))
+}
+
+// SieveAddressIs 地址头（如"from"、"to"）中的邮件地址等于address
+func SieveAddressIs(header, address string) SieveTest {
+	return SieveTest(fmt.Sprintf("address :is %s %s", quoteSieve(header), quoteSieve(address)))
+}
+
+// SieveAddressDomain 地址头中邮件地址的域名等于domain
+func SieveAddressDomain(header, domain string) SieveTest {
+	return SieveTest(fmt.Sprintf("address :domain :is %s %s", quoteSieve(header), quoteSieve(domain)))
+}
+
+// SieveSizeOver 邮件大小超过n字节
+func SieveSizeOver(n int64) SieveTest {
+	return SieveTest(fmt.Sprintf("size :over %d", n))
+}
+
+// SieveAnyOf 任一条件成立
+func SieveAnyOf(tests ...SieveTest) SieveTest {
+	return SieveTest("anyof " + sieveTestList(tests))
+}
+
+// SieveAllOf 所有条件都成立
+func SieveAllOf(tests ...SieveTest) SieveTest {
+	return SieveTest("allof " + sieveTestList(tests))
+}
+
+// SieveNot 条件不成立
+func SieveNot(test SieveTest) SieveTest {
+	return SieveTest("not " + string(test))
+}
+
+// sieveTestList 生成带括号的条件列表
+func sieveTestList(tests []SieveTest) string {
+	items := make([]string, len(tests))
+	for i, t := range tests {
+		items[i] = string(t)
+	}
+	return "(" + strings.Join(items, ", ") + ")"
+}
+
+// SieveVacation 自动回复的设置(RFC 5230)
+type SieveVacation struct {
+	Days      int      // 对同一发件人再次回复的最少间隔天数，0表示使用服务器默认值（通常为7天）
+	Subject   string   // 回复主题，为空时由服务器生成
+	From      string   // 回复的发件人地址，为空时使用收件地址
+	Addresses []string // 用户的其他地址，发往这些地址的邮件也会回复
+	Reason    string   // 回复内容
+}
+
+// SieveBuilder 生成包含常用规则的Sieve脚本(RFC 5228)
+// 规则按添加顺序执行，所有条件成立的规则都会生效；
+// 自动加入规则需要的require声明
+type SieveBuilder struct {
+	requires []string
+	rules    []string
+}
+
+// NewSieveBuilder 创建Sieve脚本生成器
+func NewSieveBuilder() *SieveBuilder {
+	return &SieveBuilder{}
+}
+
+// require 声明脚本使用的扩展
+func (b *SieveBuilder) require(ext string) {
+	for _, r := range b.requires {
+		if r == ext {
+			return
+		}
+	}
+	b.requires = append(b.requires, ext)
+}
+
+// add 添加规则，test为空表示对所有邮件执行
+func (b *SieveBuilder) add(test SieveTest, action string) *SieveBuilder {
+	if test == "" {
+		b.rules = append(b.rules, action+";")
+	} else {
+		b.rules = append(b.rules, fmt.Sprintf("if %s {\n    %s;\n}", test, action))
+	}
+	return b
+}
+
+// FileInto 将符合条件的邮件移动到指定邮箱
+// 参数:
+//   - test: 条件，为空表示所有邮件
+//   - mailbox: 目标邮箱名称
+func (b *SieveBuilder) FileInto(test SieveTest, mailbox string) *SieveBuilder {
+	b.require("fileinto")
+	return b.add(test, "fileinto "+quoteSieve(mailbox))
+}
+
+// Redirect 将符合条件的邮件转发到其他地址
+// 参数:
+//   - test: 条件，为空表示所有邮件
+//   - address: 转发的目标地址
+//   - keepCopy: 是否在本邮箱中保留一份（使用copy扩展，RFC 3894）
+func (b *SieveBuilder) Redirect(test SieveTest, address string, keepCopy bool) *SieveBuilder {
+	if keepCopy {
+		b.require("copy")
+		return b.add(test, "redirect :copy "+quoteSieve(address))
+	}
+	return b.add(test, "redirect "+quoteSieve(address))
+}
+
+// Vacation 对符合条件的邮件自动回复
+// 参数:
+//   - test: 条件，为空表示所有邮件
+//   - v: 自动回复的设置
+func (b *SieveBuilder) Vacation(test SieveTest, v SieveVacation) *SieveBuilder {
+	b.require("vacation")
+
+	var sb strings.Builder
+	sb.WriteString("vacation")
+	if v.Days > 0 {
+		fmt.Fprintf(&sb, " :days %d", v.Days)
+	}
+	if v.Subject != "" {
+		sb.WriteString(" :subject " + quoteSieve(v.Subject))
+	}
+	if v.From != "" {
+		sb.WriteString(" :from " + quoteSieve(v.From))
+	}
+	if len(v.Addresses) > 0 {
+		items := make([]string, len(v.Addresses))
+		for i, addr := range v.Addresses {
+			items[i] = quoteSieve(addr)
+		}
+		sb.WriteString(" :addresses [" + strings.Join(items, ", ") + "]")
+	}
+	sb.WriteString(" " + quoteSieve(v.Reason))
+	return b.add(test, sb.String())
+}
+
+// String 生成Sieve脚本
+func (b *SieveBuilder) String() string {
+	var sb strings.Builder
+	if len(b.requires) > 0 {
+		items := make([]string, len(b.requires))
+		for i, r := range b.requires {
+			items[i] = quoteSieve(r)
+		}
+		sb.WriteString("require [" + strings.Join(items, ", ") + "];\n")
+	}
+	for _, rule := range b.rules {
+		sb.WriteString("\n" + rule + "\n")
+	}
+	return sb.String()
+}
+
+// quoteSieve 生成Sieve的带引号字符串，转义引号和反斜杠
+func quoteSieve(s string) string {
+	return quoteIMAP(s)
+}
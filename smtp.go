@@ -2,7 +2,9 @@ package email
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/smtp"
 	"strings"
@@ -10,10 +12,11 @@ import (
 
 // SMTPClient SMTP客户端结构体
 type SMTPClient struct {
-	auth smtp.Auth
-	host string
-	port int
-	user string
+	auth  smtp.Auth
+	host  string
+	port  int
+	user  string
+	login *LoginParams // 连接参数，决定加密方式
 }
 
 // 确保SMTPClient实现了EmailSender接口
@@ -49,16 +52,106 @@ func (c *SMTPClient) MonitEmail(opt ...any) ([]*ParsedMessage, error) {
 // 返回:
 //   - error: 发送过程中的错误
 func (c *SMTPClient) SendEmail(to []string, subject, body string, attachments []*Attachment) error {
+	msg := &OutgoingMessage{
+		From:        c.user,
+		To:          to,
+		Subject:     subject,
+		Body:        body,
+		Attachments: attachments,
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// 发送邮件
+	return c.send(msg.From, to, data)
+}
+
+// SetTLS 设置连接时使用的加密方式和TLS配置
+// 参数:
+//   - mode: 加密方式，默认465端口使用隐式TLS，其他端口在服务器支持时使用STARTTLS
+//   - config: 自定义TLS配置，nil表示使用系统默认配置
+func (c *SMTPClient) SetTLS(mode TLSMode, config *tls.Config) {
+	c.login.TLSMode = mode
+	c.login.TLSConfig = config
+}
+
+// send 连接服务器发送一封邮件，按登录参数选择加密方式
+// 与smtp.SendMail相同，但支持隐式TLS和自定义TLS配置
+func (c *SMTPClient) send(from string, to []string, data []byte) error {
+	conn, err := dialConn(c.login)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	switch mode := c.login.tlsMode(); mode {
+	case TLSAuto, TLSStartTLS:
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(c.login.tlsConfig()); err != nil {
+				return err
+			}
+		} else if mode == TLSStartTLS {
+			return fmt.Errorf("smtp: server does not support STARTTLS")
+		}
+	}
+
+	if c.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(c.auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// OutgoingMessage 待发送的邮件
+// 既可以通过SMTP发送，也可以通过IMAP的Append上传到邮箱
+type OutgoingMessage struct {
+	From        string        // 发件人
+	To          []string      // 收件人列表
+	Subject     string        // 邮件主题
+	Body        string        // 邮件正文（纯文本）
+	Attachments []*Attachment // 附件列表
+}
+
+// Bytes 生成RFC 5322格式的邮件内容
+func (m *OutgoingMessage) Bytes() ([]byte, error) {
 	// 构建邮件头
-	from := c.user
 	msg := &bytes.Buffer{}
 	w := multipart.NewWriter(msg)
 
 	// 邮件头
 	headers := map[string]string{
-		"From":         from,
-		"To":           strings.Join(to, ", "),
-		"Subject":      subject,
+		"From":         m.From,
+		"To":           strings.Join(m.To, ", "),
+		"Subject":      m.Subject,
 		"MIME-Version": "1.0",
 		"Content-Type": fmt.Sprintf("multipart/mixed; boundary=%s", w.Boundary()),
 	}
@@ -73,38 +166,44 @@ func (c *SMTPClient) SendEmail(to []string, subject, body string, attachments []
 		"Content-Type": {"text/plain; charset=utf-8"},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	part.Write([]byte(body))
+	part.Write([]byte(m.Body))
 
 	// 附件
-	for _, attachment := range attachments {
+	for _, attachment := range m.Attachments {
 		part, err := w.CreatePart(map[string][]string{
 			"Content-Type":        {attachment.ContentType},
 			"Content-Disposition": {fmt.Sprintf("attachment; filename=%s", attachment.Filename)},
 		})
 		if err != nil {
-			return err
+			return nil, err
+		}
+		r, err := attachment.Open()
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(part, r)
+		r.Close()
+		if err != nil {
+			return nil, err
 		}
-		part.Write(attachment.Data)
 	}
 
 	// 结束邮件
 	w.Close()
 
-	// 发送邮件
-	auth := c.auth
-	serverAddr := fmt.Sprintf("%s:%d", c.host, c.port)
-	return smtp.SendMail(serverAddr, auth, from, to, msg.Bytes())
+	return msg.Bytes(), nil
 }
 
 // NewSMTPClient 创建新的SMTP客户端
 func NewSMTPClient(host string, port int, user, pwd string) *SMTPClient {
 	auth := smtp.PlainAuth("", user, pwd, host)
 	return &SMTPClient{
-		auth: auth,
-		host: host,
-		port: port,
-		user: user,
+		auth:  auth,
+		host:  host,
+		port:  port,
+		user:  user,
+		login: &LoginParams{Host: host, Port: port, User: user, Pwd: pwd, Proto: SMTP},
 	}
 }
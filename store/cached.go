@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/go-enols/go-log"
+
+	email "github.com/go-enols/go-email"
+)
+
+// CachedReader 带本地缓存的邮件读取客户端
+// 读取邮件时优先使用缓存，缓存中的邮件不足时才访问服务器并写入缓存；
+// 服务器不可用时退回到缓存。Offline为true或底层客户端为nil时完全不访问服务器
+type CachedReader struct {
+	email.EmailReader        // 底层读取客户端，离线使用时可为nil
+	Store             *Store // 本地缓存
+	Offline           bool   // 是否只使用缓存
+}
+
+// 确保CachedReader实现了EmailReader和MailboxStatusReader接口
+var (
+	_ email.EmailReader         = (*CachedReader)(nil)
+	_ email.MailboxStatusReader = (*CachedReader)(nil)
+)
+
+// NewCachedReader 创建带缓存的读取客户端
+// 参数:
+//   - reader: 底层读取客户端，为nil时只能离线读取
+//   - store: 本地缓存
+//
+// 返回:
+//   - *CachedReader: 带缓存的读取客户端
+func NewCachedReader(reader email.EmailReader, store *Store) *CachedReader {
+	return &CachedReader{
+		EmailReader: reader,
+		Store:       store,
+	}
+}
+
+// online 是否可以访问服务器
+func (r *CachedReader) online() bool {
+	return !r.Offline && r.EmailReader != nil
+}
+
+// GetEmail 获取邮箱中最近几封邮件，参数与EmailReader.GetEmail相同
+// 缓存中已有足够数量的邮件、且服务器上没有新邮件时直接返回缓存内容，否则从服务器刷新。
+// 底层客户端实现了email.MailboxStatusReader时才能判断是否有新邮件（IMAP比较UIDNEXT，
+// POP3比较邮件总数），否则只要缓存数量足够就使用缓存，需要最新邮件时使用Refresh
+func (r *CachedReader) GetEmail(opt ...any) ([]*email.ParsedMessage, error) {
+	n, mailbox := readerArgs(opt)
+
+	cached := r.Store.Count(mailbox)
+	if !r.online() || cached >= n && r.fresh(mailbox) {
+		return r.Store.List(mailbox, n)
+	}
+
+	messages, err := r.Refresh(n, mailbox)
+	if err != nil && cached > 0 {
+		log.Debugf("server unavailable, reading from cache: %v", err)
+		return r.Store.List(mailbox, n)
+	}
+	return messages, err
+}
+
+// Refresh 从服务器获取最近几封邮件并写入缓存，参数与EmailReader.GetEmail相同
+// 邮箱的UIDVALIDITY与上次刷新时不同时，旧的缓存已经无法与服务器上的邮件对应，会先被清空
+func (r *CachedReader) Refresh(opt ...any) ([]*email.ParsedMessage, error) {
+	if !r.online() {
+		return nil, fmt.Errorf("cached reader is offline")
+	}
+
+	n, mailbox := readerArgs(opt)
+	// 在获取邮件之前记录状态，之后到达的邮件会使下一次检查发现变化
+	state := r.status(mailbox)
+
+	// 保留原始内容，缓存中保存的是与服务器相同的邮件
+	messages, err := r.EmailReader.GetEmail(n, mailbox, email.FetchOptions{KeepRaw: true})
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		// UIDVALIDITY变化后旧邮件的UID不再有效，可能与新邮件的UID相同，需要先清空缓存
+		if last := r.Store.mailboxState(mailbox); last != nil && last.UIDValidity != state.UIDValidity {
+			log.Debugf("UIDVALIDITY of %s changed, clearing cache", mailbox)
+			if err := r.Store.Clear(mailbox); err != nil {
+				return nil, err
+			}
+		}
+		r.Store.setMailboxState(mailbox, state)
+	}
+	if err := r.put(mailbox, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// fresh 服务器上是否没有比上次刷新时更新的邮件，无法判断时返回true
+func (r *CachedReader) fresh(mailbox string) bool {
+	if _, ok := r.EmailReader.(email.MailboxStatusReader); !ok {
+		return true
+	}
+	current := r.status(mailbox)
+	if current == nil {
+		// 服务器不可用，使用缓存
+		return true
+	}
+
+	last := r.Store.mailboxState(mailbox)
+	if last == nil || last.UIDValidity != current.UIDValidity {
+		return false
+	}
+	if current.UIDNext != 0 {
+		return last.UIDNext == current.UIDNext
+	}
+	return last.Total == current.Total
+}
+
+// status 从服务器获取邮箱状态，底层客户端不支持或出错时返回nil
+func (r *CachedReader) status(mailbox string) *mailboxState {
+	sr, ok := r.EmailReader.(email.MailboxStatusReader)
+	if !ok {
+		return nil
+	}
+	status, err := sr.GetMailboxStatus(mailbox)
+	if err != nil {
+		log.Debugf("get status of %s: %v", mailbox, err)
+		return nil
+	}
+	return &mailboxState{
+		UIDValidity: status.UIDValidity,
+		UIDNext:     uint32(status.UIDNext),
+		Total:       status.TotalMessages,
+	}
+}
+
+// ListMailboxes 获取邮箱列表，离线时返回缓存中的邮箱
+func (r *CachedReader) ListMailboxes() ([]string, error) {
+	if !r.online() {
+		return r.Store.Mailboxes(), nil
+	}
+	return r.EmailReader.ListMailboxes()
+}
+
+// MonitEmail 监听新邮件并写入缓存，离线时不支持
+func (r *CachedReader) MonitEmail(opt ...any) ([]*email.ParsedMessage, error) {
+	if !r.online() {
+		return nil, fmt.Errorf("cached reader is offline")
+	}
+
+	_, mailbox := readerArgs(opt)
+	messages, err := r.EmailReader.MonitEmail(opt...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.put(mailbox, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetMailboxStatus 获取邮箱状态
+// 离线或底层客户端没有实现email.MailboxStatusReader时只包含缓存中的邮件数量
+func (r *CachedReader) GetMailboxStatus(mailbox string) (*email.MailboxStatus, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if r.online() {
+		if sr, ok := r.EmailReader.(email.MailboxStatusReader); ok {
+			return sr.GetMailboxStatus(mailbox)
+		}
+	}
+	return &email.MailboxStatus{
+		Name:          mailbox,
+		TotalMessages: r.Store.Count(mailbox),
+	}, nil
+}
+
+// Close 保存缓存索引并关闭底层客户端
+func (r *CachedReader) Close() error {
+	err := r.Store.Flush()
+	if r.EmailReader != nil {
+		if closeErr := r.EmailReader.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// put 将邮件写入缓存并保存索引
+func (r *CachedReader) put(mailbox string, messages []*email.ParsedMessage) error {
+	for _, msg := range messages {
+		if _, err := r.Store.Put(mailbox, msg); err != nil {
+			return err
+		}
+	}
+	return r.Store.Flush()
+}
+
+// readerArgs 解析GetEmail风格的参数，返回邮件数量和邮箱名称
+func readerArgs(opt []any) (int, string) {
+	var n = 10
+	var mailbox = "INBOX"
+	for _, v := range opt {
+		switch val := v.(type) {
+		case int:
+			n = val
+		case string:
+			mailbox = val
+		}
+	}
+	return n, mailbox
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+
+	email "github.com/go-enols/go-email"
+)
+
+// fakeReader 内存中的单邮箱读取客户端
+type fakeReader struct {
+	validity uint32
+	messages []*email.ParsedMessage // 从旧到新
+	fetches  int                    // GetEmail的调用次数
+}
+
+func (f *fakeReader) Close() error { return nil }
+
+func (f *fakeReader) GetEmail(opt ...any) ([]*email.ParsedMessage, error) {
+	f.fetches++
+	n, _ := readerArgs(opt)
+	if n < len(f.messages) {
+		return f.messages[len(f.messages)-n:], nil
+	}
+	return f.messages, nil
+}
+
+func (f *fakeReader) ListMailboxes() ([]string, error) { return []string{"INBOX"}, nil }
+
+func (f *fakeReader) MonitEmail(opt ...any) ([]*email.ParsedMessage, error) { return nil, nil }
+
+func (f *fakeReader) GetMailboxStatus(mailbox string) (*email.MailboxStatus, error) {
+	var next imap.UID = 1
+	if len(f.messages) > 0 {
+		next = f.messages[len(f.messages)-1].UID + 1
+	}
+	return &email.MailboxStatus{
+		Name:          mailbox,
+		TotalMessages: len(f.messages),
+		UIDNext:       next,
+		UIDValidity:   f.validity,
+	}, nil
+}
+
+func TestCachedReaderFresh(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeReader{validity: 1, messages: []*email.ParsedMessage{
+		testMessage(1, "one", ""), testMessage(2, "two", ""),
+	}}
+	r := NewCachedReader(server, s)
+
+	for i, want := range []int{1, 1, 2} {
+		if i == 2 {
+			// 新邮件到达后UIDNEXT变化，缓存不再有效
+			server.messages = append(server.messages, testMessage(3, "three", ""))
+		}
+		msgs, err := r.GetEmail(2, "INBOX")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if server.fetches != want {
+			t.Errorf("call %d: %d fetches, want %d", i, server.fetches, want)
+		}
+		if last := msgs[len(msgs)-1].Subject; last != server.messages[len(server.messages)-1].Subject {
+			t.Errorf("call %d: newest message %q", i, last)
+		}
+	}
+}
+
+// UIDVALIDITY变化后，旧邮件应从缓存中删除，UID相同的新邮件不能与旧邮件混在一起
+func TestCachedReaderUIDValidityReset(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeReader{validity: 1, messages: []*email.ParsedMessage{
+		testMessage(1, "旧邮件一", ""), testMessage(2, "旧邮件二", ""), testMessage(3, "旧邮件三", ""),
+	}}
+	r := NewCachedReader(server, s)
+	if _, err := r.GetEmail(3, "INBOX"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 邮箱被重建，UID从1重新开始
+	server.validity = 2
+	server.messages = []*email.ParsedMessage{testMessage(1, "新邮件", "")}
+	msgs, err := r.GetEmail(1, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "新邮件" {
+		t.Fatalf("GetEmail returned %d messages", len(msgs))
+	}
+
+	if n := s.Count("INBOX"); n != 1 {
+		t.Errorf("Count = %d, want 1", n)
+	}
+	if got := s.Search("旧邮件", nil); len(got) != 0 {
+		t.Errorf("old messages still searchable: %q", entrySubjects(got))
+	}
+	cached, err := s.List("INBOX", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 || cached[0].Subject != "新邮件" {
+		t.Errorf("List returned %d messages", len(cached))
+	}
+	if state := s.mailboxState("INBOX"); state == nil || state.UIDValidity != 2 {
+		t.Errorf("state = %+v", state)
+	}
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// indexFile 索引文件名
+const indexFile = "index.json"
+
+// Entry 缓存中一封邮件的索引信息
+type Entry struct {
+	Key         string    // 邮件在邮箱内的唯一标识
+	Mailbox     string    // 所属邮箱
+	File        string    // Maildir文件相对于缓存目录的路径
+	UID         uint32    // IMAP UID，POP3邮件为0
+	MessageID   string    // Message-ID
+	Subject     string    // 邮件主题
+	From        string    // 发件人
+	To          string    // 收件人
+	Date        time.Time // 邮件时间
+	Flags       []string  // 邮件标志
+	Size        int64     // 邮件大小（字节）
+	Attachments int       // 附件数量
+}
+
+// Field 可检索的字段
+type Field string
+
+const (
+	FieldSubject Field = "subject" // 邮件主题
+	FieldFrom    Field = "from"    // 发件人名称和地址
+	FieldBody    Field = "body"    // 邮件正文
+)
+
+// allFields 默认检索的字段
+var allFields = []Field{FieldSubject, FieldFrom, FieldBody}
+
+// mailboxState 最近一次从服务器刷新邮箱时的状态，用于判断缓存中是否缺少新邮件
+type mailboxState struct {
+	UIDValidity uint32 // IMAP UIDVALIDITY
+	UIDNext     uint32 // IMAP UIDNEXT，POP3为0
+	Total       int    // 邮件总数
+}
+
+// index 缓存索引，保存邮件元数据和全文检索的倒排表
+type index struct {
+	Entries   map[string]*Entry        // 键为entryID
+	Postings  map[string][]string      // 词 -> entryID列表
+	Mailboxes map[string]*mailboxState // 邮箱名称 -> 最近一次刷新时的状态
+}
+
+func newIndex() *index {
+	return &index{
+		Entries:   make(map[string]*Entry),
+		Postings:  make(map[string][]string),
+		Mailboxes: make(map[string]*mailboxState),
+	}
+}
+
+// entryID 邮件在整个缓存中的唯一标识
+func entryID(mailbox, key string) string {
+	return mailbox + "\x00" + key
+}
+
+// loadIndex 从缓存目录读取索引，文件不存在时返回空索引
+func loadIndex(dir string) (*index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if os.IsNotExist(err) {
+		return newIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newIndex()
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// save 将索引写入缓存目录，先写临时文件再重命名，避免写入中断损坏索引
+func (idx *index) save(dir string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, indexFile))
+}
+
+// add 将邮件某个字段的文本加入倒排表
+func (idx *index) add(id string, field Field, text string) {
+	for _, token := range tokenize(text, false) {
+		key := string(field) + ":" + token
+		ids := idx.Postings[key]
+		i := sort.SearchStrings(ids, id)
+		if i < len(ids) && ids[i] == id {
+			continue
+		}
+		ids = append(ids, "")
+		copy(ids[i+1:], ids[i:])
+		ids[i] = id
+		idx.Postings[key] = ids
+	}
+}
+
+// remove 从索引中删除邮件
+func (idx *index) remove(id string) {
+	delete(idx.Entries, id)
+	for token, ids := range idx.Postings {
+		i := sort.SearchStrings(ids, id)
+		if i < len(ids) && ids[i] == id {
+			ids = append(ids[:i], ids[i+1:]...)
+			if len(ids) == 0 {
+				delete(idx.Postings, token)
+			} else {
+				idx.Postings[token] = ids
+			}
+		}
+	}
+}
+
+// search 返回在指定字段中包含查询中所有词的邮件
+func (idx *index) search(query string, fields []Field) []string {
+	tokens := tokenize(query, true)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var result []string
+	for i, token := range tokens {
+		// 同一个词在任一字段中出现即可
+		var ids []string
+		for _, field := range fields {
+			ids = union(ids, idx.Postings[string(field)+":"+token])
+		}
+
+		if i == 0 {
+			result = ids
+		} else {
+			result = intersect(result, ids)
+		}
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// union 求两个有序列表的并集
+func union(a, b []string) []string {
+	out := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		default:
+			out = append(out, b[j])
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// intersect 求两个有序列表的交集
+func intersect(a, b []string) []string {
+	var out []string
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+// tokenize 将文本切分为检索词
+// 字母和数字按单词切分并转为小写；中日韩文字没有空格分隔，索引时同时记录单字和相邻两字，
+// 查询时连续两个字以上只使用相邻两字，以减少误匹配
+func tokenize(text string, query bool) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	addToken := func(t string) {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+
+	var word, cjk []rune
+	flush := func() {
+		addToken(string(word))
+		word = word[:0]
+
+		for i, r := range cjk {
+			if !query || len(cjk) == 1 {
+				addToken(string(r))
+			}
+			if i > 0 {
+				addToken(string(cjk[i-1 : i+1]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			if len(word) > 0 {
+				flush()
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(cjk) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// isCJK 是否为中日韩文字
+// 长音符"ー"不属于片假名，但总是出现在假名单词中间，如"メール"
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) || r == 'ー'
+}
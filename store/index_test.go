@@ -0,0 +1,80 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text  string
+		query bool
+		want  []string
+	}{
+		{"Hello, World! hello", false, []string{"hello", "world"}},
+		{"发票", false, []string{"发", "票", "发票"}},
+		{"电子发票", false, []string{"电", "子", "电子", "发", "子发", "票", "发票"}},
+		{"电子发票", true, []string{"电子", "子发", "发票"}},
+		{"票", true, []string{"票"}},
+		{"Invoice发票2024", false, []string{"invoice", "发", "票", "发票", "2024"}},
+		{"メール 메일", false, []string{"メ", "ー", "メー", "ル", "ール", "메", "일", "메일"}},
+		{"  ,.;  ", false, nil},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q, %v) = %q, want %q", tt.text, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := newIndex()
+	idx.add("a", FieldSubject, "本月电子发票")
+	idx.add("a", FieldFrom, "billing@example.com")
+	idx.add("b", FieldSubject, "发送报告")
+	idx.add("b", FieldBody, "Quarterly report attached")
+	idx.add("c", FieldBody, "票据已发出")
+
+	tests := []struct {
+		query  string
+		fields []Field
+		want   []string
+	}{
+		{"发票", allFields, []string{"a"}},              // 相邻两字，不匹配"票据已发出"
+		{"发", allFields, []string{"a", "b", "c"}},     // 单字
+		{"REPORT", allFields, []string{"b"}},          // 不区分大小写
+		{"report 发送", allFields, []string{"b"}},       // 所有词都需要出现，可以在不同字段中
+		{"report", []Field{FieldSubject}, nil},        // 只检索主题
+		{"example billing", allFields, []string{"a"}}, // 地址按单词切分
+		{"发票 report", allFields, nil},
+		{"", allFields, nil},
+	}
+	for _, tt := range tests {
+		got := idx.search(tt.query, tt.fields)
+		if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q, %v) = %q, want %q", tt.query, tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	idx := newIndex()
+	idx.Entries["a"] = &Entry{Key: "a"}
+	idx.Entries["b"] = &Entry{Key: "b"}
+	idx.add("a", FieldSubject, "会议 meeting")
+	idx.add("b", FieldSubject, "meeting notes")
+
+	idx.remove("a")
+	if _, ok := idx.Entries["a"]; ok {
+		t.Error("entry not removed")
+	}
+	if got := idx.search("meeting", allFields); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("search after remove = %q", got)
+	}
+	// 只属于被删除邮件的词应从倒排表中删除
+	for _, token := range []string{"subject:会", "subject:会议"} {
+		if _, ok := idx.Postings[token]; ok {
+			t.Errorf("posting %q not removed", token)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+// Package store 将IMAP/POP3邮箱镜像到本地磁盘，提供离线列表、读取和全文检索
+//
+// 邮件以Maildir格式保存在<dir>/<邮箱>/cur目录下，元数据和倒排索引保存在<dir>/index.json中。
+package store
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message/mail"
+
+	email "github.com/go-enols/go-email"
+)
+
+// maildirFlags IMAP标志与Maildir文件名标志的对应关系
+var maildirFlags = map[imap.Flag]byte{
+	imap.FlagDraft:    'D',
+	imap.FlagFlagged:  'F',
+	imap.FlagAnswered: 'R',
+	imap.FlagSeen:     'S',
+	imap.FlagDeleted:  'T',
+}
+
+// Store 本地邮件缓存
+// 可以被多个goroutine同时使用
+type Store struct {
+	dir string
+
+	mu    sync.RWMutex
+	index *index
+	dirty bool
+}
+
+// SearchOptions 检索选项
+type SearchOptions struct {
+	Mailbox string  // 只在该邮箱中检索，为空表示所有邮箱
+	Fields  []Field // 检索的字段，默认为主题、发件人和正文
+	Limit   int     // 最多返回的结果数量，0表示不限制
+}
+
+// Open 打开位于dir的缓存，目录不存在时自动创建
+// 参数:
+//   - dir: 缓存目录
+//
+// 返回:
+//   - *Store: 缓存实例
+//   - error: 打开过程中的错误
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	idx, err := loadIndex(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load index: %w", err)
+	}
+
+	return &Store{
+		dir:   dir,
+		index: idx,
+	}, nil
+}
+
+// Close 保存索引
+func (s *Store) Close() error {
+	return s.Flush()
+}
+
+// Flush 将索引的修改写入磁盘
+// Put和Remove只修改内存中的索引，批量写入后应调用Flush
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	if err := s.index.save(s.dir); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Put 将邮件保存到缓存，已存在的邮件会被覆盖
+// 参数:
+//   - mailbox: 邮件所属的邮箱
+//   - msg: 要保存的邮件
+//
+// 返回:
+//   - *Entry: 邮件的索引信息
+//   - error: 保存过程中的错误
+func (s *Store) Put(mailbox string, msg *email.ParsedMessage) (*Entry, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	// 保留了原始内容时原样保存，否则根据解析结果重新生成
+	data := msg.Raw
+	if len(data) == 0 {
+		var err error
+		data, err = composeMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("compose message: %w", err)
+		}
+	}
+
+	key := messageKey(msg)
+	entry := &Entry{
+		Key:         key,
+		Mailbox:     mailbox,
+		UID:         uint32(msg.UID),
+		MessageID:   msg.MessageID,
+		Subject:     msg.Subject,
+		From:        formatAddresses(msg.From),
+		To:          formatAddresses(msg.To),
+		Date:        msg.InternalDate,
+		Size:        msg.Size,
+		Attachments: len(msg.Attachments),
+	}
+	for _, flag := range msg.Flags {
+		entry.Flags = append(entry.Flags, string(flag))
+	}
+	if entry.Size == 0 {
+		entry.Size = int64(len(data))
+	}
+	entry.File = filepath.Join(mailboxDir(mailbox), "cur", maildirName(entry))
+
+	if err := s.writeMaildir(entry, data); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := entryID(mailbox, key)
+	if old, ok := s.index.Entries[id]; ok {
+		if old.File != entry.File {
+			os.Remove(filepath.Join(s.dir, old.File))
+		}
+		s.index.remove(id)
+	}
+
+	s.index.Entries[id] = entry
+	s.index.add(id, FieldSubject, msg.Subject)
+	s.index.add(id, FieldFrom, entry.From)
+	body := msg.TextBody
+	if body == "" {
+		body = stripTags(msg.HTMLBody)
+	}
+	s.index.add(id, FieldBody, body)
+	s.dirty = true
+
+	return entry, nil
+}
+
+// writeMaildir 按Maildir的方式写入邮件：先写入tmp目录，再移动到cur目录
+func (s *Store) writeMaildir(entry *Entry, data []byte) error {
+	base := filepath.Join(s.dir, mailboxDir(entry.Mailbox))
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(base, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	tmp := filepath.Join(base, "tmp", entry.Key)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, entry.File))
+}
+
+// Get 从缓存读取邮件
+// 参数:
+//   - mailbox: 邮件所属的邮箱
+//   - key: 邮件的唯一标识，来自Entry.Key
+//
+// 返回:
+//   - *email.ParsedMessage: 解析后的邮件
+//   - error: 邮件不存在或读取过程中的错误
+func (s *Store) Get(mailbox, key string) (*email.ParsedMessage, error) {
+	s.mu.RLock()
+	entry, ok := s.index.Entries[entryID(mailbox, key)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("message %s not found in mailbox %s", key, mailbox)
+	}
+	return s.load(entry)
+}
+
+// load 读取并解析邮件文件
+func (s *Store) load(entry *Entry) (*email.ParsedMessage, error) {
+	f, err := os.Open(filepath.Join(s.dir, entry.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := email.ParseMessage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.UID = imap.UID(entry.UID)
+	msg.Size = entry.Size
+	msg.InternalDate = entry.Date
+	msg.Flags = nil
+	for _, flag := range entry.Flags {
+		msg.Flags = append(msg.Flags, imap.Flag(flag))
+	}
+	return msg, nil
+}
+
+// mailboxState 返回最近一次刷新邮箱时记录的状态，没有记录时返回nil
+func (s *Store) mailboxState(mailbox string) *mailboxState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if state, ok := s.index.Mailboxes[mailbox]; ok {
+		copied := *state
+		return &copied
+	}
+	return nil
+}
+
+// setMailboxState 记录刷新邮箱时的状态，随索引一起保存
+func (s *Store) setMailboxState(mailbox string, state *mailboxState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index.Mailboxes[mailbox] = state
+	s.dirty = true
+}
+
+// Entries 返回邮箱中所有邮件的索引信息，按时间从新到旧排序
+func (s *Store) Entries(mailbox string) []*Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []*Entry
+	for _, entry := range s.index.Entries {
+		if entry.Mailbox == mailbox {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// Count 返回邮箱中缓存的邮件数量
+func (s *Store) Count(mailbox string) int {
+	return len(s.Entries(mailbox))
+}
+
+// List 读取邮箱中最新的n封邮件，顺序与EmailReader.GetEmail一致（从旧到新）
+// 参数:
+//   - mailbox: 邮箱名称
+//   - n: 邮件数量
+//
+// 返回:
+//   - []*email.ParsedMessage: 邮件列表
+//   - error: 读取过程中的错误
+func (s *Store) List(mailbox string, n int) ([]*email.ParsedMessage, error) {
+	entries := s.Entries(mailbox)
+	if n >= 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	messages := make([]*email.ParsedMessage, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg, err := s.load(entries[i])
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", entries[i].Key, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// Mailboxes 返回缓存中的所有邮箱名称
+func (s *Store) Mailboxes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range s.index.Entries {
+		if !seen[entry.Mailbox] {
+			seen[entry.Mailbox] = true
+			names = append(names, entry.Mailbox)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Search 在缓存中检索邮件，结果按时间从新到旧排序
+// 查询中的所有词都需要出现（在任一检索字段中），英文按单词匹配且不区分大小写
+// 参数:
+//   - query: 查询文本
+//   - options: 检索选项，可为nil
+//
+// 返回:
+//   - []*Entry: 匹配的邮件索引信息，可通过Get读取完整邮件
+func (s *Store) Search(query string, options *SearchOptions) []*Entry {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+	fields := options.Fields
+	if len(fields) == 0 {
+		fields = allFields
+	}
+
+	s.mu.RLock()
+	var entries []*Entry
+	for _, id := range s.index.search(query, fields) {
+		entry := s.index.Entries[id]
+		if entry == nil || (options.Mailbox != "" && entry.Mailbox != options.Mailbox) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	s.mu.RUnlock()
+
+	sortEntries(entries)
+	if options.Limit > 0 && len(entries) > options.Limit {
+		entries = entries[:options.Limit]
+	}
+	return entries
+}
+
+// Remove 从缓存中删除邮件
+func (s *Store) Remove(mailbox, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := entryID(mailbox, key)
+	entry, ok := s.index.Entries[id]
+	if !ok {
+		return nil
+	}
+	s.index.remove(id)
+	s.dirty = true
+
+	err := os.Remove(filepath.Join(s.dir, entry.File))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Clear 删除邮箱的全部缓存
+func (s *Store) Clear(mailbox string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, entry := range s.index.Entries {
+		if entry.Mailbox == mailbox {
+			s.index.remove(id)
+			s.dirty = true
+		}
+	}
+	if _, ok := s.index.Mailboxes[mailbox]; ok {
+		delete(s.index.Mailboxes, mailbox)
+		s.dirty = true
+	}
+	return os.RemoveAll(filepath.Join(s.dir, mailboxDir(mailbox)))
+}
+
+// Rebuild 清空邮箱的缓存，并从服务器重新获取最新的n封邮件
+// 参数:
+//   - reader: 邮件读取客户端
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - n: 要获取的邮件数量
+//
+// 返回:
+//   - error: 获取或保存过程中的错误
+func (s *Store) Rebuild(reader email.EmailReader, mailbox string, n int) error {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	messages, err := reader.GetEmail(n, mailbox, email.FetchOptions{KeepRaw: true})
+	if err != nil {
+		return err
+	}
+
+	if err := s.Clear(mailbox); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if _, err := s.Put(mailbox, msg); err != nil {
+			return err
+		}
+	}
+	return s.Flush()
+}
+
+// sortEntries 按时间从新到旧排序，时间相同时按UID排序
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.After(entries[j].Date)
+		}
+		return entries[i].UID > entries[j].UID
+	})
+}
+
+// messageKey 生成邮件在邮箱内的唯一标识
+// IMAP邮件使用UID，其他邮件使用Message-ID的摘要
+func messageKey(msg *email.ParsedMessage) string {
+	if msg.UID != 0 {
+		return strconv.FormatUint(uint64(msg.UID), 10)
+	}
+
+	source := msg.MessageID
+	if source == "" {
+		source = msg.Subject + "\x00" + formatAddresses(msg.From) + "\x00" + msg.InternalDate.String()
+	}
+	sum := sha1.Sum([]byte(source))
+	return hex.EncodeToString(sum[:8])
+}
+
+// mailboxDir 邮箱在缓存目录中的子目录名
+func mailboxDir(mailbox string) string {
+	return url.PathEscape(mailbox)
+}
+
+// maildirSeparator Maildir文件名中标志部分的分隔符
+// Windows的文件名不能包含":"，与其他Maildir实现一样改用"!"
+var maildirSeparator = func() string {
+	if runtime.GOOS == "windows" {
+		return "!"
+	}
+	return ":"
+}()
+
+// maildirName 生成Maildir文件名，格式为"<时间>.<标识>:2,<标志>"，Windows上为"<时间>.<标识>!2,<标志>"
+func maildirName(entry *Entry) string {
+	var flags []byte
+	for _, flag := range entry.Flags {
+		if c, ok := maildirFlags[imap.Flag(flag)]; ok {
+			flags = append(flags, c)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+
+	return fmt.Sprintf("%d.%s%s2,%s", entry.Date.Unix(), entry.Key, maildirSeparator, flags)
+}
+
+// formatAddresses 将地址列表格式化为字符串
+func formatAddresses(addrs []*mail.Address) string {
+	parts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		if addr.Name != "" {
+			parts[i] = addr.Name + " <" + addr.Address + ">"
+		} else {
+			parts[i] = addr.Address
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// composeMessage 将解析后的邮件重新生成为RFC 5322格式
+func composeMessage(msg *email.ParsedMessage) ([]byte, error) {
+	var h mail.Header
+	date := msg.InternalDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	h.SetDate(date)
+	h.SetSubject(msg.Subject)
+	h.SetAddressList("From", msg.From)
+	h.SetAddressList("To", msg.To)
+	if len(msg.Cc) > 0 {
+		h.SetAddressList("Cc", msg.Cc)
+	}
+	if msg.MessageID != "" {
+		h.SetMessageID(msg.MessageID)
+	}
+
+	var buf bytes.Buffer
+	w, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.TextBody != "" || msg.HTMLBody != "" {
+		iw, err := w.CreateInline()
+		if err != nil {
+			return nil, err
+		}
+		bodies := []struct{ mediaType, body string }{
+			{"text/plain", msg.TextBody},
+			{"text/html", msg.HTMLBody},
+		}
+		for _, b := range bodies {
+			if b.body == "" {
+				continue
+			}
+			var ih mail.InlineHeader
+			ih.SetContentType(b.mediaType, map[string]string{"charset": "utf-8"})
+			pw, err := iw.CreatePart(ih)
+			if err != nil {
+				return nil, err
+			}
+			io.WriteString(pw, b.body)
+			pw.Close()
+		}
+		iw.Close()
+	}
+
+	for _, a := range msg.Attachments {
+		var ah mail.AttachmentHeader
+		mediaType, params, err := mime.ParseMediaType(a.ContentType)
+		if err != nil {
+			mediaType, params = "application/octet-stream", nil
+		}
+		ah.SetContentType(mediaType, params)
+		ah.SetFilename(a.Filename)
+
+		aw, err := w.CreateAttachment(ah)
+		if err != nil {
+			return nil, err
+		}
+		r, err := a.Open()
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(aw, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		aw.Close()
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stripTags 粗略去除HTML标签，用于建立正文索引
+func stripTags(html string) string {
+	var sb strings.Builder
+	inTag := false
+	for _, r := range html {
+		switch {
+		case r == '<':
+			inTag = true
+			sb.WriteRune(' ')
+		case r == '>':
+			inTag = false
+		case !inTag:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-message/mail"
+
+	email "github.com/go-enols/go-email"
+)
+
+// testMessage 返回一封简单的测试邮件
+func testMessage(uid imap.UID, subject, body string) *email.ParsedMessage {
+	return &email.ParsedMessage{
+		UID:          uid,
+		MessageID:    subject + "@example.com",
+		Subject:      subject,
+		From:         []*mail.Address{{Name: "Alice", Address: "alice@example.com"}},
+		To:           []*mail.Address{{Address: "bob@example.com"}},
+		InternalDate: time.Date(2024, 1, 1, 0, 0, int(uid), 0, time.UTC),
+		TextBody:     body,
+	}
+}
+
+// entrySubjects 返回检索结果中的邮件主题
+func entrySubjects(entries []*Entry) []string {
+	subjects := make([]string, len(entries))
+	for i, entry := range entries {
+		subjects[i] = entry.Subject
+	}
+	return subjects
+}
+
+func TestStorePutOverwrite(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.Put("INBOX", testMessage(1, "电子发票", "请查收"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一UID再次写入时覆盖旧邮件，旧的检索词和文件都应删除
+	msg := testMessage(1, "会议通知", "请查收")
+	msg.Flags = []imap.Flag{imap.FlagSeen}
+	second, err := s.Put("INBOX", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Count("INBOX"); n != 1 {
+		t.Fatalf("Count = %d, want 1", n)
+	}
+	if got := s.Search("发票", nil); len(got) != 0 {
+		t.Errorf("old subject still indexed: %q", entrySubjects(got))
+	}
+	if got := s.Search("会议", nil); len(got) != 1 {
+		t.Errorf("Search(会议) = %q", entrySubjects(got))
+	}
+	if first.File == second.File {
+		t.Fatalf("flags not reflected in file name %s", second.File)
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, first.File)); !os.IsNotExist(err) {
+		t.Errorf("old file %s not removed", first.File)
+	}
+
+	got, err := s.Get("INBOX", second.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "会议通知" || got.UID != 1 || len(got.Flags) != 1 {
+		t.Errorf("Get = %q uid %d flags %v", got.Subject, got.UID, got.Flags)
+	}
+}
+
+func TestStoreRemoveAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []*email.ParsedMessage{
+		testMessage(1, "Invoice 2024", "电子发票已开具"),
+		testMessage(2, "Weekly report", "本周工作报告"),
+		testMessage(3, "发票补开", "see attachment"),
+	} {
+		if _, err := s.Put("INBOX", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Put("Archive", testMessage(2, "旧发票", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		options *SearchOptions
+		want    []string
+	}{
+		{"发票", nil, []string{"发票补开", "旧发票", "Invoice 2024"}},
+		{"发票", &SearchOptions{Mailbox: "INBOX"}, []string{"发票补开", "Invoice 2024"}},
+		{"发票", &SearchOptions{Fields: []Field{FieldSubject}}, []string{"发票补开", "旧发票"}},
+		{"发票", &SearchOptions{Limit: 1}, []string{"发票补开"}},
+		{"alice", &SearchOptions{Mailbox: "Archive"}, []string{"旧发票"}},
+		{"报告 weekly", nil, []string{"Weekly report"}},
+	}
+	for _, tt := range tests {
+		got := entrySubjects(s.Search(tt.query, tt.options))
+		if len(got) != len(tt.want) {
+			t.Errorf("Search(%q, %+v) = %q, want %q", tt.query, tt.options, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Search(%q, %+v) = %q, want %q", tt.query, tt.options, got, tt.want)
+				break
+			}
+		}
+	}
+
+	entry := s.Search("invoice", nil)[0]
+	if err := s.Remove("INBOX", entry.Key); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Search("invoice", nil); len(got) != 0 {
+		t.Errorf("removed message still found: %q", entrySubjects(got))
+	}
+	if _, err := os.Stat(filepath.Join(dir, entry.File)); !os.IsNotExist(err) {
+		t.Errorf("file %s not removed", entry.File)
+	}
+
+	// 重新打开后索引与关闭前相同
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entrySubjects(s.Search("发票", nil)); len(got) != 2 {
+		t.Errorf("after reopen: %q", got)
+	}
+	if n := s.Count("INBOX"); n != 2 {
+		t.Errorf("Count after reopen = %d, want 2", n)
+	}
+}
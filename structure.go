@@ -0,0 +1,428 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// MIMEPart 邮件MIME结构中的一个部分
+type MIMEPart struct {
+	Part        []int             // 部分编号，如[1 2]对应BODY[1.2]，整封单部分邮件为[1]
+	MediaType   string            // 内容类型，如"text/plain"
+	Params      map[string]string // Content-Type参数，如charset
+	Encoding    string            // 传输编码，如"base64"
+	Size        uint32            // 编码后的大小（字节）
+	Filename    string            // 文件名，没有时为空
+	Disposition string            // Content-Disposition，如"attachment"、"inline"
+	ContentID   string            // Content-ID，内嵌图片使用
+	Children    []*MIMEPart       // 子部分，仅multipart类型存在
+}
+
+// newMIMEPart 将IMAP BODYSTRUCTURE转换为MIMEPart树
+func newMIMEPart(bs imap.BodyStructure, path []int) *MIMEPart {
+	part := &MIMEPart{
+		Part:      path,
+		MediaType: bs.MediaType(),
+	}
+	if disp := bs.Disposition(); disp != nil {
+		part.Disposition = strings.ToLower(disp.Value)
+	}
+
+	switch bs := bs.(type) {
+	case *imap.BodyStructureSinglePart:
+		if len(path) == 0 {
+			part.Part = []int{1}
+		}
+		part.Params = bs.Params
+		part.Encoding = strings.ToLower(bs.Encoding)
+		part.Size = bs.Size
+		part.Filename = bs.Filename()
+		part.ContentID = strings.Trim(bs.ID, "<>")
+	case *imap.BodyStructureMultiPart:
+		for i, child := range bs.Children {
+			childPath := append(append([]int{}, path...), i+1)
+			part.Children = append(part.Children, newMIMEPart(child, childPath))
+		}
+	}
+	return part
+}
+
+// PartID 部分编号的字符串形式，如"1.2"
+func (p *MIMEPart) PartID() string {
+	ids := make([]string, len(p.Part))
+	for i, n := range p.Part {
+		ids[i] = strconv.Itoa(n)
+	}
+	return strings.Join(ids, ".")
+}
+
+// IsMultipart 是否为multipart类型
+func (p *MIMEPart) IsMultipart() bool {
+	return strings.HasPrefix(p.MediaType, "multipart/")
+}
+
+// IsAttachment 是否为附件
+// 声明为attachment，或带有文件名的非文本部分均视为附件
+func (p *MIMEPart) IsAttachment() bool {
+	if p.IsMultipart() {
+		return false
+	}
+	if p.Disposition == "attachment" {
+		return true
+	}
+	return p.Filename != "" && !strings.HasPrefix(p.MediaType, "text/")
+}
+
+// Walk 按深度优先顺序遍历所有部分（包括自身），fn返回false时不再遍历其子部分
+func (p *MIMEPart) Walk(fn func(part *MIMEPart) bool) {
+	if !fn(p) {
+		return
+	}
+	for _, child := range p.Children {
+		child.Walk(fn)
+	}
+}
+
+// Find 查找第一个指定内容类型且不是附件的部分，未找到返回nil
+func (p *MIMEPart) Find(mediaType string) *MIMEPart {
+	var found *MIMEPart
+	p.Walk(func(part *MIMEPart) bool {
+		if found != nil {
+			return false
+		}
+		if part.MediaType == mediaType && !part.IsAttachment() {
+			found = part
+		}
+		return true
+	})
+	return found
+}
+
+// Attachments 返回所有附件部分
+func (p *MIMEPart) Attachments() []*MIMEPart {
+	var parts []*MIMEPart
+	p.Walk(func(part *MIMEPart) bool {
+		if part.IsAttachment() {
+			parts = append(parts, part)
+		}
+		return true
+	})
+	return parts
+}
+
+// GetEmailHeaders 获取指定邮箱中最近几封邮件的摘要信息
+// 只获取信封、标志、大小和BODYSTRUCTURE，不下载邮件正文
+// 正文可以随后通过LoadBody按需获取，附件在调用Attachment.Open时才会下载
+// 参数(通过opt ...any传递):
+//   - int: [可选] 要获取的邮件数量，默认为10封
+//   - string: [可选] 邮箱名称，默认为"INBOX"(收件箱)
+//
+// 返回:
+//   - []*ParsedMessage: 邮件列表，TextBody和HTMLBody为空，Structure为MIME结构
+//   - error: 获取过程中的错误
+func (c *ImapClient) GetEmailHeaders(opt ...any) ([]*ParsedMessage, error) {
+	var n = 10
+	var mailbox = "INBOX"
+	// 处理传入的参数
+	for _, v := range opt {
+		switch val := v.(type) {
+		case int:
+			n = val
+		case string:
+			mailbox = val
+		}
+	}
+
+	var messages []*ParsedMessage
+	err := c.withConn(func() (err error) {
+		messages, err = c.getEmailHeaders(n, mailbox)
+		return err
+	})
+	return messages, err
+}
+
+// getEmailHeaders 获取邮箱中最近n封邮件的摘要信息
+func (c *ImapClient) getEmailHeaders(n int, mailbox string) ([]*ParsedMessage, error) {
+	// 选择邮箱
+	selected, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	numMessages := int(selected.NumMessages)
+	if numMessages == 0 {
+		return []*ParsedMessage{}, nil
+	}
+
+	start := numMessages - n + 1
+	if start < 1 {
+		start = 1
+	}
+
+	seqSet := imap.SeqSet{
+		{
+			Start: uint32(start),
+			Stop:  uint32(numMessages),
+		},
+	}
+
+	msgs, err := c.client.Fetch(seqSet, headersFetchOptions()).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*ParsedMessage, 0, len(msgs))
+	for _, buf := range msgs {
+		parsedMsg, err := c.parseMessageBuffer(buf)
+		if err != nil {
+			return nil, err
+		}
+		parsedMsg.Attachments = c.lazyAttachments(mailbox, parsedMsg)
+		messages = append(messages, parsedMsg)
+	}
+
+	return messages, nil
+}
+
+// referencesSection References头字段，信封中不包含该字段，会话归并时需要
+var referencesSection = &imap.FetchItemBodySection{
+	Specifier:    imap.PartSpecifierHeader,
+	HeaderFields: []string{"References"},
+	Peek:         true,
+}
+
+// headersFetchOptions 仅获取摘要信息的FETCH选项
+func headersFetchOptions() *imap.FetchOptions {
+	return &imap.FetchOptions{
+		Flags:         true,
+		InternalDate:  true,
+		RFC822Size:    true,
+		Envelope:      true,
+		UID:           true,
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+		BodySection:   []*imap.FetchItemBodySection{referencesSection},
+	}
+}
+
+// FetchPart 按需获取邮件的某个MIME部分，使用BODY.PEEK不会将邮件标记为已读
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uid: 邮件UID
+//   - part: 要获取的部分，通常来自ParsedMessage.Structure
+//
+// 返回:
+//   - []byte: 已按Content-Transfer-Encoding解码的内容
+//   - error: 获取过程中的错误
+func (c *ImapClient) FetchPart(mailbox string, uid imap.UID, part *MIMEPart) ([]byte, error) {
+	r, err := c.OpenPart(mailbox, uid, part)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode part %s: %w", part.PartID(), err)
+	}
+	return data, nil
+}
+
+// OpenPart 读取邮件的某个MIME部分
+// 内容在持有会话锁期间全部下载，超过附件内存阈值（未设置时为1MB）的部分写入临时文件，
+// 因此大附件不会整体读入内存，读取返回的Reader时也不会阻塞该客户端上的其他调用
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uid: 邮件UID
+//   - part: 要获取的部分，通常来自ParsedMessage.Structure
+//
+// 返回:
+//   - io.ReadCloser: 已按Content-Transfer-Encoding解码的内容，调用方必须关闭
+//   - error: 获取过程中的错误
+func (c *ImapClient) OpenPart(mailbox string, uid imap.UID, part *MIMEPart) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := c.withConn(func() (err error) {
+		r, err = c.openPart(mailbox, uid, part)
+		return err
+	})
+	return r, err
+}
+
+// openPart OpenPart的实现
+func (c *ImapClient) openPart(mailbox string, uid imap.UID, part *MIMEPart) (io.ReadCloser, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	// 选择邮箱
+	_, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := c.client.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		UID: true,
+		BodySection: []*imap.FetchItemBodySection{
+			{Part: part.Part, Peek: true},
+		},
+	})
+
+	msg := cmd.Next()
+	if msg == nil {
+		if err := cmd.Close(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("message uid %d not found", uid)
+	}
+
+	for item := msg.Next(); item != nil; item = msg.Next() {
+		section, ok := item.(imapclient.FetchItemDataBodySection)
+		if !ok || section.Literal == nil {
+			continue
+		}
+
+		// 释放会话锁之前读完内容，之后其他命令（包括Watch的IDLE）才能使用连接
+		limit := c.attachmentMemLimit
+		if limit <= 0 {
+			limit = defaultSpoolLimit
+		}
+		r, err := spool(decodeTransferEncoding(section.Literal, part.Encoding), limit)
+		if err != nil {
+			cmd.Close()
+			return nil, fmt.Errorf("read part %s: %w", part.PartID(), err)
+		}
+		if err := cmd.Close(); err != nil {
+			r.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+
+	if err := cmd.Close(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("part %s of message uid %d not returned", part.PartID(), uid)
+}
+
+// LoadBody 为通过GetEmailHeaders获取的邮件加载纯文本和HTML正文
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - msg: 需要带有Structure的邮件
+//
+// 返回:
+//   - error: 获取过程中的错误
+func (c *ImapClient) LoadBody(mailbox string, msg *ParsedMessage) error {
+	if msg.Structure == nil {
+		return fmt.Errorf("message uid %d has no body structure", msg.UID)
+	}
+
+	if part := msg.Structure.Find("text/plain"); part != nil {
+		data, err := c.FetchPart(mailbox, msg.UID, part)
+		if err != nil {
+			return err
+		}
+		msg.TextBody = string(data)
+	}
+
+	if part := msg.Structure.Find("text/html"); part != nil {
+		data, err := c.FetchPart(mailbox, msg.UID, part)
+		if err != nil {
+			return err
+		}
+		msg.HTMLBody = string(data)
+	}
+
+	return nil
+}
+
+// FetchAttachment 按需下载邮件中的单个附件
+// 附件超过内存阈值(SetAttachmentMemLimit)时写入临时文件
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - uid: 邮件UID
+//   - part: 附件部分，通常来自MIMEPart.Attachments
+//
+// 返回:
+//   - *Attachment: 下载的附件
+//   - error: 获取过程中的错误
+func (c *ImapClient) FetchAttachment(mailbox string, uid imap.UID, part *MIMEPart) (*Attachment, error) {
+	r, err := c.OpenPart(mailbox, uid, part)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return newAttachment(partFilename(part), part.MediaType, r, c.attachmentMemLimit)
+}
+
+// lazyAttachments 根据MIME结构创建按需下载的附件列表
+// 附件内容在调用Attachment.Open时才通过OpenPart从服务器读取
+func (c *ImapClient) lazyAttachments(mailbox string, msg *ParsedMessage) []*Attachment {
+	if msg.Structure == nil {
+		return nil
+	}
+
+	var attachments []*Attachment
+	for _, part := range msg.Structure.Attachments() {
+		part := part
+		uid := msg.UID
+		attachments = append(attachments, &Attachment{
+			Filename:    partFilename(part),
+			ContentType: part.MediaType,
+			Size:        int64(part.Size),
+			open: func() (io.ReadCloser, error) {
+				return c.OpenPart(mailbox, uid, part)
+			},
+		})
+	}
+	return attachments
+}
+
+// partFilename 附件的文件名，没有时返回"attachment"
+func partFilename(part *MIMEPart) string {
+	if part.Filename == "" {
+		return "attachment"
+	}
+	return part.Filename
+}
+
+// decodeTransferEncoding 按Content-Transfer-Encoding解码内容
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// base64Cleaner 去除base64内容中的换行和空白
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		switch b {
+		case '\r', '\n', ' ', '\t':
+			continue
+		}
+		p[j] = b
+		j++
+	}
+	if j == 0 && n > 0 && err == nil {
+		// 全部为空白时继续读取，避免返回0字节
+		return c.Read(p)
+	}
+	return j, err
+}
@@ -0,0 +1,312 @@
+package email
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// SyncState 邮箱的同步状态，应由调用方持久化并在下次同步时传入
+type SyncState struct {
+	Mailbox       string      // 邮箱名称
+	UIDValidity   uint32      // UIDVALIDITY，变化时需要重新完整同步
+	HighestModSeq uint64      // 上次同步时的HIGHESTMODSEQ，服务器不支持CONDSTORE时为0
+	LastUID       imap.UID    // 已同步的最大UID
+	UIDs          imap.UIDSet // 已同步的全部UID，用于检测被删除的邮件
+}
+
+// FlagChange 邮件标志的变化
+type FlagChange struct {
+	UID    imap.UID    // 邮件UID
+	Flags  []imap.Flag // 邮件当前的全部标志
+	ModSeq uint64      // 邮件的修改序列号，服务器不支持CONDSTORE时为0
+}
+
+// SyncResult 一次增量同步的结果
+type SyncResult struct {
+	FullResync bool             // 是否为完整同步（首次同步或UIDVALIDITY变化），此时调用方应丢弃本地缓存
+	New        []*ParsedMessage // 新邮件的摘要信息（不含正文）
+	Changed    []*FlagChange    // 标志发生变化的邮件
+	Vanished   []imap.UID       // 已被删除的邮件UID
+	State      *SyncState       // 同步后的新状态
+}
+
+// Sync 增量同步邮箱，只返回自上次同步以来的变化
+// 服务器支持QRESYNC(RFC 7162)时，通过辅助连接以EXAMINE ... (QRESYNC ...)一次获取
+// 被删除的邮件(VANISHED)和标志的变化（底层库不支持这些响应）；
+// 否则支持CONDSTORE时通过CHANGEDSINCE只获取标志有变化的邮件，被删除的邮件通过比较UID集合得到；
+// 都不支持时Changed中包含所有已同步邮件的当前标志，由调用方自行比较。
+// state为nil或UIDVALIDITY发生变化时进行完整同步
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - state: 上次同步返回的状态，首次同步传nil
+//
+// 返回:
+//   - *SyncResult: 同步结果
+//   - error: 同步过程中的错误
+func (c *ImapClient) Sync(mailbox string, state *SyncState) (*SyncResult, error) {
+	var result *SyncResult
+	err := c.withConn(func() (err error) {
+		result, err = c.syncMailbox(mailbox, state)
+		return err
+	})
+	return result, err
+}
+
+// syncMailbox Sync的实现
+func (c *ImapClient) syncMailbox(mailbox string, state *SyncState) (*SyncResult, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	caps := c.client.Caps()
+	condStore := caps.Has(imap.CapCondStore)
+
+	// 选择邮箱
+	selected, err := c.selectMailbox(mailbox, &imap.SelectOptions{
+		ReadOnly:  true,
+		CondStore: condStore,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{
+		State: &SyncState{
+			Mailbox:       mailbox,
+			UIDValidity:   selected.UIDValidity,
+			HighestModSeq: selected.HighestModSeq,
+		},
+	}
+
+	if state == nil || state.UIDValidity != selected.UIDValidity {
+		result.FullResync = true
+		return result, c.syncNew(selected.NumMessages, 0, result)
+	}
+
+	result.State.LastUID = state.LastUID
+
+	qresync := caps.Has(imap.CapQResync) && state.HighestModSeq != 0 && len(state.UIDs) > 0
+	switch {
+	case qresync && selected.HighestModSeq == state.HighestModSeq:
+		// 删除邮件和修改标志都会增大HIGHESTMODSEQ，没有任何变化
+		result.State.UIDs.AddSet(state.UIDs)
+	case qresync && state.LastUID > 0:
+		if err := c.syncQResync(mailbox, state, result); err != nil {
+			return nil, err
+		}
+	case state.LastUID > 0:
+		// 检测被删除的邮件
+		current, err := c.searchUIDs(imap.UIDSet{{Start: 1, Stop: state.LastUID}})
+		if err != nil {
+			return nil, err
+		}
+		result.State.UIDs = current
+		if uids, ok := state.UIDs.Nums(); ok {
+			for _, uid := range uids {
+				if !current.Contains(uid) {
+					result.Vanished = append(result.Vanished, uid)
+				}
+			}
+		}
+
+		// 检测标志的变化
+		if err := c.syncChanged(state, condStore && selected.HighestModSeq != 0, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, c.syncNew(selected.NumMessages, state.LastUID, result)
+}
+
+// syncQResync 通过QRESYNC获取已同步邮件的删除和标志变化
+func (c *ImapClient) syncQResync(mailbox string, state *SyncState, result *SyncResult) error {
+	var data *qresyncData
+	err := c.withRaw(func(r *rawIMAP) (err error) {
+		data, err = r.qresync(mailbox, state)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("qresync: %w", err)
+	}
+	if data.uidValidity != 0 && data.uidValidity != state.UIDValidity {
+		return fmt.Errorf("qresync: UIDVALIDITY of %s changed during sync", mailbox)
+	}
+
+	// 变化以辅助连接选择邮箱时为准
+	if data.highestModSeq != 0 {
+		result.State.HighestModSeq = data.highestModSeq
+	}
+
+	uids, _ := state.UIDs.Nums()
+	for _, uid := range uids {
+		if data.vanished.Contains(uid) {
+			result.Vanished = append(result.Vanished, uid)
+		} else {
+			result.State.UIDs.AddNum(uid)
+		}
+	}
+	for _, change := range data.changed {
+		// 新邮件由syncNew获取
+		if change.UID <= state.LastUID && !data.vanished.Contains(change.UID) {
+			result.Changed = append(result.Changed, change)
+		}
+	}
+	return nil
+}
+
+// qresyncData 以QRESYNC选择邮箱时服务器返回的变化
+type qresyncData struct {
+	uidValidity   uint32
+	highestModSeq uint64
+	vanished      imap.UIDSet
+	changed       []*FlagChange
+}
+
+// qresync 启用QRESYNC并以只读方式选择邮箱，解析VANISHED (EARLIER)和FETCH响应
+func (c *rawIMAP) qresync(mailbox string, state *SyncState) (*qresyncData, error) {
+	if !c.qresyncEnabled {
+		if _, err := c.command("ENABLE", "QRESYNC"); err != nil {
+			return nil, err
+		}
+		c.qresyncEnabled = true
+	}
+
+	params := fmt.Sprintf("(QRESYNC (%d %d 1:%d))", state.UIDValidity, state.HighestModSeq, state.LastUID)
+	c.mailbox = ""
+	responses, err := c.command("EXAMINE", quoteIMAP(encodeMailboxName(mailbox)), params)
+	if err != nil {
+		return nil, err
+	}
+	c.mailbox = mailbox
+	c.readOnly = true
+
+	data := &qresyncData{}
+	for _, resp := range responses {
+		if len(resp) < 2 {
+			continue
+		}
+		switch {
+		case strings.EqualFold(atomString(resp[0]), "OK"):
+			// 如"[UIDVALIDITY 3857529045]"
+			code := strings.Fields(strings.Trim(atomString(resp[1]), "[]"))
+			if len(code) != 2 {
+				continue
+			}
+			switch strings.ToUpper(code[0]) {
+			case "UIDVALIDITY":
+				n, _ := strconv.ParseUint(code[1], 10, 32)
+				data.uidValidity = uint32(n)
+			case "HIGHESTMODSEQ":
+				data.highestModSeq, _ = strconv.ParseUint(code[1], 10, 64)
+			}
+		case strings.EqualFold(atomString(resp[0]), "VANISHED"):
+			// VANISHED (EARLIER) uid-set
+			uids, err := parseUIDSet(atomString(resp[len(resp)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("parse VANISHED: %w", err)
+			}
+			data.vanished.AddSet(uids)
+		case len(resp) >= 3 && strings.EqualFold(atomString(resp[1]), "FETCH"):
+			items, _ := resp[2].(rawList)
+			change := &FlagChange{Flags: []imap.Flag{}}
+			for i := 0; i+1 < len(items); i += 2 {
+				switch strings.ToUpper(atomString(items[i])) {
+				case "UID":
+					uid, _ := strconv.ParseUint(atomString(items[i+1]), 10, 32)
+					change.UID = imap.UID(uid)
+				case "FLAGS":
+					flags, _ := items[i+1].(rawList)
+					for _, flag := range flags {
+						change.Flags = append(change.Flags, imap.Flag(atomString(flag)))
+					}
+				case "MODSEQ":
+					if modSeq, ok := items[i+1].(rawList); ok && len(modSeq) == 1 {
+						change.ModSeq, _ = strconv.ParseUint(atomString(modSeq[0]), 10, 64)
+					}
+				}
+			}
+			if change.UID != 0 {
+				data.changed = append(data.changed, change)
+			}
+		}
+	}
+	return data, nil
+}
+
+// syncNew 获取UID大于lastUID的新邮件
+func (c *ImapClient) syncNew(numMessages uint32, lastUID imap.UID, result *SyncResult) error {
+	if numMessages == 0 {
+		return nil
+	}
+
+	uidSet := imap.UIDSet{{Start: lastUID + 1, Stop: 0}} // lastUID+1:*
+	msgs, err := c.client.Fetch(uidSet, headersFetchOptions()).Collect()
+	if err != nil {
+		return err
+	}
+
+	for _, buf := range msgs {
+		// 没有新邮件时"n:*"仍会返回最后一封邮件
+		if buf.UID <= lastUID {
+			continue
+		}
+		msg, err := c.parseMessageBuffer(buf)
+		if err != nil {
+			return err
+		}
+		result.New = append(result.New, msg)
+		result.State.UIDs.AddNum(buf.UID)
+		if buf.UID > result.State.LastUID {
+			result.State.LastUID = buf.UID
+		}
+	}
+	return nil
+}
+
+// syncChanged 获取已同步邮件的标志变化
+func (c *ImapClient) syncChanged(state *SyncState, condStore bool, result *SyncResult) error {
+	options := &imap.FetchOptions{
+		UID:   true,
+		Flags: true,
+	}
+	if condStore && state.HighestModSeq != 0 {
+		if result.State.HighestModSeq == state.HighestModSeq {
+			// 没有任何变化
+			return nil
+		}
+		options.ModSeq = true
+		options.ChangedSince = state.HighestModSeq
+	}
+
+	uidSet := imap.UIDSet{{Start: 1, Stop: state.LastUID}}
+	msgs, err := c.client.Fetch(uidSet, options).Collect()
+	if err != nil {
+		return fmt.Errorf("fetch changed flags: %w", err)
+	}
+
+	for _, buf := range msgs {
+		result.Changed = append(result.Changed, &FlagChange{
+			UID:    buf.UID,
+			Flags:  buf.Flags,
+			ModSeq: buf.ModSeq,
+		})
+	}
+	return nil
+}
+
+// searchUIDs 获取指定范围内仍然存在的邮件UID
+func (c *ImapClient) searchUIDs(uidSet imap.UIDSet) (imap.UIDSet, error) {
+	data, err := c.client.UIDSearch(&imap.SearchCriteria{
+		UID: []imap.UIDSet{uidSet},
+	}, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var uids imap.UIDSet
+	uids.AddNum(data.AllUIDs()...)
+	return uids, nil
+}
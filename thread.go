@@ -0,0 +1,366 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-message/mail"
+)
+
+// Thread 会话树中的一个节点
+// 服务器返回的会话只包含UID；客户端归并的会话同时包含邮件内容。
+// 会话中缺失的邮件（只在其他邮件的References中出现）以UID为0、Message为nil的占位节点表示
+type Thread struct {
+	UID       imap.UID       // 邮件UID，占位节点或POP3邮件为0
+	MessageID string         // 邮件ID，仅客户端归并时有效
+	Message   *ParsedMessage // 邮件内容，仅客户端归并时有效
+	Children  []*Thread      // 回复该邮件的邮件
+}
+
+// Walk 深度优先遍历会话树，fn返回false时不再遍历该节点的子节点
+func (t *Thread) Walk(fn func(t *Thread) bool) {
+	if !fn(t) {
+		return
+	}
+	for _, child := range t.Children {
+		child.Walk(fn)
+	}
+}
+
+// Count 会话中的邮件数量，不包括占位节点
+func (t *Thread) Count() int {
+	var n int
+	t.Walk(func(t *Thread) bool {
+		if t.UID != 0 || t.Message != nil {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Sort 使用服务器的SORT扩展对邮件排序，返回排序后的UID
+// 服务器不支持SORT时在客户端根据邮件摘要排序
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - criteria: 排序条件，如{Key: imapclient.SortKeyDate, Reverse: true}，按顺序依次比较
+//   - search: 筛选条件，nil表示邮箱中的全部邮件
+//
+// 返回:
+//   - []imap.UID: 排序后的邮件UID
+//   - error: 排序过程中的错误
+func (c *ImapClient) Sort(mailbox string, criteria []imapclient.SortCriterion, search *imap.SearchCriteria) ([]imap.UID, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if search == nil {
+		search = &imap.SearchCriteria{}
+	}
+	if len(criteria) == 0 {
+		criteria = []imapclient.SortCriterion{{Key: imapclient.SortKeyArrival}}
+	}
+
+	var uids []imap.UID
+	err := c.withConn(func() error {
+		if _, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+			return err
+		}
+
+		if c.client.Caps().Has(imap.CapSort) {
+			nums, err := c.client.UIDSort(&imapclient.SortOptions{
+				SearchCriteria: search,
+				SortCriteria:   criteria,
+			}).Wait()
+			if err != nil {
+				return err
+			}
+			uids = make([]imap.UID, len(nums))
+			for i, n := range nums {
+				uids[i] = imap.UID(n)
+			}
+			return nil
+		}
+
+		messages, err := c.searchHeaders(mailbox, search)
+		if err != nil {
+			return err
+		}
+		SortMessages(messages, criteria)
+		uids = make([]imap.UID, len(messages))
+		for i, msg := range messages {
+			uids[i] = msg.UID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// Thread 使用服务器的THREAD扩展将邮件归并为会话
+// 服务器不支持指定的算法时获取邮件摘要，在客户端使用相同的算法归并，此时节点中包含邮件内容
+// 参数:
+//   - mailbox: 邮箱名称，默认为"INBOX"
+//   - algorithm: imap.ThreadReferences或imap.ThreadOrderedSubject，默认为ThreadReferences
+//   - search: 筛选条件，nil表示邮箱中的全部邮件
+//
+// 返回:
+//   - []*Thread: 会话列表
+//   - error: 归并过程中的错误
+func (c *ImapClient) Thread(mailbox string, algorithm imap.ThreadAlgorithm, search *imap.SearchCriteria) ([]*Thread, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if algorithm == "" {
+		algorithm = imap.ThreadReferences
+	}
+	if algorithm != imap.ThreadReferences && algorithm != imap.ThreadOrderedSubject {
+		return nil, fmt.Errorf("unsupported thread algorithm %s", algorithm)
+	}
+	if search == nil {
+		search = &imap.SearchCriteria{}
+	}
+
+	var threads []*Thread
+	err := c.withConn(func() error {
+		if _, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+			return err
+		}
+
+		if hasThreadAlgorithm(c.client.Caps(), algorithm) {
+			data, err := c.client.UIDThread(&imapclient.ThreadOptions{
+				Algorithm:      algorithm,
+				SearchCriteria: search,
+			}).Wait()
+			if err != nil {
+				return err
+			}
+			threads = newThreads(data)
+			return nil
+		}
+
+		messages, err := c.searchHeaders(mailbox, search)
+		if err != nil {
+			return err
+		}
+		if algorithm == imap.ThreadOrderedSubject {
+			threads = ThreadBySubject(messages)
+		} else {
+			threads = BuildThreads(messages)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+// searchHeaders 获取符合条件的邮件摘要，调用方必须已选中邮箱
+func (c *ImapClient) searchHeaders(mailbox string, search *imap.SearchCriteria) ([]*ParsedMessage, error) {
+	data, err := c.client.UIDSearch(search, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	uids := data.AllUIDs()
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := c.client.Fetch(imap.UIDSetNum(uids...), headersFetchOptions()).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*ParsedMessage, 0, len(msgs))
+	for _, buf := range msgs {
+		msg, err := c.parseMessageBuffer(buf)
+		if err != nil {
+			return nil, err
+		}
+		msg.Attachments = c.lazyAttachments(mailbox, msg)
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// hasThreadAlgorithm 服务器是否支持指定的会话算法
+func hasThreadAlgorithm(caps imap.CapSet, algorithm imap.ThreadAlgorithm) bool {
+	for _, alg := range caps.ThreadAlgorithms() {
+		if strings.EqualFold(string(alg), string(algorithm)) {
+			return true
+		}
+	}
+	return false
+}
+
+// newThreads 将THREAD响应转换为会话树
+// Chain中的邮件依次为父子关系，SubThreads是Chain中最后一封邮件的子会话；
+// Chain为空表示服务器省略了缺失的父邮件
+func newThreads(data []imapclient.ThreadData) []*Thread {
+	threads := make([]*Thread, 0, len(data))
+	for _, d := range data {
+		threads = append(threads, newThread(d))
+	}
+	return threads
+}
+
+func newThread(data imapclient.ThreadData) *Thread {
+	root := &Thread{}
+	node := root
+	for i, uid := range data.Chain {
+		if i == 0 {
+			root.UID = imap.UID(uid)
+			continue
+		}
+		child := &Thread{UID: imap.UID(uid)}
+		node.Children = append(node.Children, child)
+		node = child
+	}
+	for _, sub := range data.SubThreads {
+		node.Children = append(node.Children, newThread(sub))
+	}
+	return root
+}
+
+// SortMessages 在客户端按排序条件对邮件排序，排序条件的含义与SORT扩展(RFC 5256)相同
+func SortMessages(messages []*ParsedMessage, criteria []imapclient.SortCriterion) {
+	sort.SliceStable(messages, func(i, j int) bool {
+		for _, criterion := range criteria {
+			cmp := compareMessages(messages[i], messages[j], criterion.Key)
+			if cmp == 0 {
+				continue
+			}
+			if criterion.Reverse {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return messages[i].UID < messages[j].UID
+	})
+}
+
+// compareMessages 按单个排序字段比较两封邮件
+func compareMessages(a, b *ParsedMessage, key imapclient.SortKey) int {
+	switch key {
+	case imapclient.SortKeyArrival, imapclient.SortKeyDate:
+		return a.InternalDate.Compare(b.InternalDate)
+	case imapclient.SortKeySize:
+		switch {
+		case a.Size < b.Size:
+			return -1
+		case a.Size > b.Size:
+			return 1
+		}
+		return 0
+	case imapclient.SortKeySubject:
+		return strings.Compare(BaseSubject(a.Subject), BaseSubject(b.Subject))
+	case imapclient.SortKeyFrom:
+		return strings.Compare(firstMailbox(a.From), firstMailbox(b.From))
+	case imapclient.SortKeyTo:
+		return strings.Compare(firstMailbox(a.To), firstMailbox(b.To))
+	case imapclient.SortKeyCc:
+		return strings.Compare(firstMailbox(a.Cc), firstMailbox(b.Cc))
+	}
+	return 0
+}
+
+// firstMailbox 返回第一个地址的用户名部分，SORT扩展按此比较地址
+func firstMailbox(addrs []*mail.Address) string {
+	if len(addrs) == 0 {
+		return ""
+	}
+	mailbox, _, _ := strings.Cut(addrs[0].Address, "@")
+	return strings.ToLower(mailbox)
+}
+
+// subjectPrefixes 回复和转发时添加的主题前缀
+var subjectPrefixes = []string{"re:", "fw:", "fwd:", "aw:", "sv:", "回复:", "回复：", "答复:", "答复：", "转发:", "转发："}
+
+// BaseSubject 去除主题中的回复、转发前缀和多余空白，并转为小写，用于判断两封邮件是否属于同一话题
+func BaseSubject(subject string) string {
+	s := strings.ToLower(strings.Join(strings.Fields(subject), " "))
+	for {
+		trimmed := strings.TrimSpace(s)
+		// 去除"[tag]"形式的列表前缀
+		if strings.HasPrefix(trimmed, "[") {
+			if end := strings.Index(trimmed, "]"); end > 0 {
+				rest := strings.TrimSpace(trimmed[end+1:])
+				if rest != "" {
+					trimmed = rest
+				}
+			}
+		}
+		for _, prefix := range subjectPrefixes {
+			if strings.HasPrefix(trimmed, prefix) {
+				trimmed = strings.TrimSpace(trimmed[len(prefix):])
+				break
+			}
+		}
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+// isReply 主题是否带有回复或转发前缀
+func isReply(subject string) bool {
+	s := strings.ToLower(strings.TrimSpace(subject))
+	if strings.HasPrefix(s, "[") {
+		if end := strings.Index(s, "]"); end > 0 {
+			s = strings.TrimSpace(s[end+1:])
+		}
+	}
+	for _, prefix := range subjectPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreadBySubject 按ORDEREDSUBJECT算法在客户端归并会话：主题相同（忽略回复前缀）的邮件
+// 属于同一会话，会话内按时间排列，第一封邮件为根，其余邮件为根的子节点
+func ThreadBySubject(messages []*ParsedMessage) []*Thread {
+	sorted := append([]*ParsedMessage(nil), messages...)
+	SortMessages(sorted, []imapclient.SortCriterion{{Key: imapclient.SortKeySubject}, {Key: imapclient.SortKeyDate}})
+
+	var threads []*Thread
+	var root *Thread
+	var subject string
+	for _, msg := range sorted {
+		node := newMessageThread(msg)
+		base := BaseSubject(msg.Subject)
+		if root == nil || base != subject {
+			root = node
+			subject = base
+			threads = append(threads, root)
+			continue
+		}
+		root.Children = append(root.Children, node)
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].Message.InternalDate.Before(threads[j].Message.InternalDate)
+	})
+	return threads
+}
+
+// newMessageThread 为邮件创建会话节点
+func newMessageThread(msg *ParsedMessage) *Thread {
+	return &Thread{
+		UID:       msg.UID,
+		MessageID: normalizeMessageID(msg.MessageID),
+		Message:   msg,
+	}
+}
+
+// normalizeMessageID 去除邮件ID两侧的尖括号和空白
+func normalizeMessageID(id string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(id), "<>"))
+}
@@ -1,11 +1,18 @@
 package email
 
+import (
+	"crypto/tls"
+
+	"github.com/emersion/go-imap/v2"
+)
+
 type EmailProto int
 
 const (
 	IMAP EmailProto = iota
 	POP3
 	SMTP
+	SIEVE // ManageSieve(RFC 5804)，用于管理服务器端的过滤脚本
 )
 
 type LoginParams struct {
@@ -15,6 +22,17 @@ type LoginParams struct {
 	Pwd   string
 	Proto EmailProto
 
-	ClientId     string // oauth2认证需要
-	RefreshToken string // oauth2认证需要
+	TLSMode   TLSMode     // 加密方式，默认根据端口选择
+	TLSConfig *tls.Config // 自定义TLS配置，如信任私有CA或客户端证书；nil表示使用系统默认配置
+	Dialer    Dialer      // 自定义拨号器，如NewProxyDialer创建的代理；nil表示直接连接
+
+	DisableCompress bool         // 不使用IMAP的COMPRESS=DEFLATE压缩（默认在服务器支持时启用）
+	ClientIdentity  *imap.IDData // 登录后通过IMAP ID命令发送的客户端信息，nil表示使用DefaultClientIdentity
+
+	ClientId     string // oauth2认证需要，与RefreshToken都设置时使用XOAUTH2登录，否则使用密码登录
+	RefreshToken string // oauth2认证需要，通过Microsoft的令牌接口换取访问令牌
+
+	AttachmentMemLimit int64 // 附件保存在内存中的最大字节数，超出时写入临时文件；0表示不限制
+
+	Reconnect *ReconnectPolicy // IMAP断线重连策略，nil表示使用默认策略
 }
@@ -15,7 +15,7 @@ type TokenResponse struct {
 	ErrorDescription string `json:"error_description"`
 }
 
-func getAccessTokenFromRefreshToken(refreshToken, clientID string) (map[string]interface{}, error) {
+func getAccessTokenFromRefreshToken(client *http.Client, refreshToken, clientID string) (map[string]interface{}, error) {
 	url := "https://login.microsoftonline.com/common/oauth2/v2.0/token"
 
 	data := map[string]string{
@@ -41,7 +41,6 @@ func getAccessTokenFromRefreshToken(refreshToken, clientID string) (map[string]i
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
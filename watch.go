@@ -0,0 +1,439 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/go-enols/go-log"
+)
+
+const (
+	// idleRestartInterval IDLE的重新发送间隔，RFC 2177要求客户端至少每29分钟重新发送一次
+	idleRestartInterval = 29 * time.Minute
+	// noopPollInterval 服务器不支持IDLE时发送NOOP轮询的间隔
+	noopPollInterval = 30 * time.Second
+)
+
+// MailboxEventType 邮箱事件类型
+type MailboxEventType int
+
+const (
+	MailboxEventNewMessage   MailboxEventType = iota // 收到新邮件
+	MailboxEventExpunge                              // 邮件被删除
+	MailboxEventFlagsChanged                         // 邮件标志发生变化
+	MailboxEventError                                // 监听出错，之后事件通道会被关闭
+	MailboxEventReconnected                          // 连接断开后已重新连接，期间的变化可能丢失，调用方应重新同步
+)
+
+// MailboxEvent 邮箱事件
+type MailboxEvent struct {
+	Type    MailboxEventType
+	Mailbox string         // 事件所属的邮箱
+	SeqNum  uint32         // 邮件序号，Expunge事件中为被删除邮件的序号
+	UID     imap.UID       // 邮件UID，Expunge事件中为0
+	Flags   []imap.Flag    // 邮件当前的标志，仅FlagsChanged事件有效
+	Message *ParsedMessage // 新邮件的摘要信息（不含正文），仅NewMessage事件有效
+	Err     error          // 错误信息，Error事件为出错原因，Reconnected事件为导致断线的错误
+}
+
+// unilateralEvent 服务器主动推送的数据
+type unilateralEvent struct {
+	numMessages *uint32                        // EXISTS
+	expunge     uint32                         // EXPUNGE
+	fetch       *imapclient.FetchMessageBuffer // FETCH
+}
+
+// unilateralQueue 缓存服务器主动推送的数据，供Watch处理
+// 处理器运行在客户端的读取goroutine中，因此只做入队，不能阻塞
+type unilateralQueue struct {
+	mu     sync.Mutex
+	active bool
+	events []unilateralEvent
+	notify chan struct{}
+}
+
+func newUnilateralQueue() *unilateralQueue {
+	return &unilateralQueue{notify: make(chan struct{}, 1)}
+}
+
+// handler 创建安装到imapclient.Options上的处理器
+func (q *unilateralQueue) handler() *imapclient.UnilateralDataHandler {
+	return &imapclient.UnilateralDataHandler{
+		Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+			if data.NumMessages != nil {
+				n := *data.NumMessages
+				q.push(unilateralEvent{numMessages: &n})
+			}
+		},
+		Expunge: func(seqNum uint32) {
+			q.push(unilateralEvent{expunge: seqNum})
+		},
+		Fetch: func(msg *imapclient.FetchMessageData) {
+			// 必须读完数据，否则会阻塞客户端
+			buf, err := msg.Collect()
+			if err != nil {
+				log.Debugf("error reading unilateral fetch: %v", err)
+				return
+			}
+			q.push(unilateralEvent{fetch: buf})
+		},
+	}
+}
+
+func (q *unilateralQueue) push(ev unilateralEvent) {
+	q.mu.Lock()
+	active := q.active
+	if active {
+		q.events = append(q.events, ev)
+	}
+	q.mu.Unlock()
+
+	if active {
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// start 开始缓存事件，已有监听者时返回false
+func (q *unilateralQueue) start() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active {
+		return false
+	}
+	q.active = true
+	q.events = nil
+	return true
+}
+
+// stop 停止缓存事件
+func (q *unilateralQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active = false
+	q.events = nil
+}
+
+// drain 取出所有已缓存的事件
+func (q *unilateralQueue) drain() []unilateralEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// Watch 持续监听邮箱变化，返回事件通道
+// 服务器支持IDLE时依靠服务器推送（每29分钟重新发送IDLE），否则定期发送NOOP轮询。
+// ctx被取消后监听停止并关闭通道；出错时会先发送一个Error事件再关闭通道。
+// 连接断开时按重连策略自动重连，成功后发送Reconnected事件并继续监听，
+// 断线期间的变化不会产生事件，调用方可以在收到该事件后通过Sync重新同步。
+// 监听期间仍然可以在其他goroutine中使用该客户端，此时IDLE会暂停，
+// 其他调用结束后重新选择被监听的邮箱并补发期间到达的新邮件。
+// 同一时间每个客户端只能有一个监听者
+// 参数:
+//   - ctx: 用于停止监听的上下文
+//   - mailbox: 要监听的邮箱名称，默认为"INBOX"
+//
+// 返回:
+//   - <-chan *MailboxEvent: 邮箱事件通道
+//   - error: 开始监听时的错误
+func (c *ImapClient) Watch(ctx context.Context, mailbox string) (<-chan *MailboxEvent, error) {
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if c.unilateral == nil {
+		return nil, fmt.Errorf("client was not created with AutoLogin or ImapConnect")
+	}
+
+	w := &mailboxWatcher{
+		client:  c,
+		mailbox: mailbox,
+		events:  make(chan *MailboxEvent, 64),
+	}
+
+	// 选择邮箱
+	err := c.withConn(func() error {
+		selected, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		caps := c.client.Caps()
+		w.useIdle = caps.Has(imap.CapIdle) || caps.Has(imap.CapIMAP4rev2)
+		w.numMessages = selected.NumMessages
+		w.selectGen = c.selectGen
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.unilateral.start() {
+		return nil, fmt.Errorf("mailbox watcher already running")
+	}
+	go w.run(ctx)
+
+	return w.events, nil
+}
+
+// mailboxWatcher 单个邮箱的监听者
+type mailboxWatcher struct {
+	client      *ImapClient
+	mailbox     string
+	useIdle     bool
+	numMessages uint32
+	selectGen   uint64 // 监听者最后一次确认邮箱被选中时的selectGen
+	events      chan *MailboxEvent
+	pending     []*MailboxEvent // 持有会话锁期间产生、尚未发送的事件
+}
+
+func (w *mailboxWatcher) run(ctx context.Context) {
+	defer close(w.events)
+	defer w.client.unilateral.stop()
+
+	c := w.client
+	for {
+		if !w.useIdle && !w.wait(ctx) {
+			return
+		}
+
+		c.mu.Lock()
+		err := w.step(ctx)
+		c.mu.Unlock()
+
+		if err != nil && ctx.Err() == nil {
+			w.emit(&MailboxEvent{Type: MailboxEventError, Mailbox: w.mailbox, Err: err})
+		}
+		w.flush(ctx)
+		if err != nil || ctx.Err() != nil {
+			return
+		}
+
+		// 有其他调用在等待会话锁时，等它们都拿到锁后再继续
+		for c.waiting.Load() > 0 {
+			select {
+			case <-c.acquired:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// step 持有会话锁执行一轮监听：确认邮箱仍被选中，IDLE或NOOP，然后处理推送数据
+func (w *mailboxWatcher) step(ctx context.Context) error {
+	c := w.client
+
+	err := c.ensureConn()
+	if err == nil {
+		err = w.resume(ctx)
+	}
+	if err == nil {
+		if w.useIdle {
+			err = w.idle(ctx)
+		} else {
+			err = c.client.Noop().Wait()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = w.handlePending(ctx)
+	}
+	if err != nil && c.autoReconnect() && c.broken(err) {
+		err = w.recover(ctx, err)
+	}
+	return err
+}
+
+// resume 其他调用切换过邮箱时重新选择被监听的邮箱，并补发期间到达的新邮件
+func (w *mailboxWatcher) resume(ctx context.Context) error {
+	c := w.client
+	if c.selectGen == w.selectGen {
+		return nil
+	}
+
+	selected, err := c.selectMailbox(w.mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	w.selectGen = c.selectGen
+
+	// 其他邮箱被选中期间的推送数据与被监听的邮箱无关
+	c.unilateral.drain()
+
+	from := w.numMessages + 1
+	w.numMessages = selected.NumMessages
+	if from > w.numMessages {
+		return nil
+	}
+	return w.fetchNew(ctx, from)
+}
+
+// wait 等待一个轮询间隔，ctx被取消时返回false
+func (w *mailboxWatcher) wait(ctx context.Context) bool {
+	timer := time.NewTimer(noopPollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// recover 连接断开后重新连接并选择邮箱，成功后发送Reconnected事件
+func (w *mailboxWatcher) recover(ctx context.Context, cause error) error {
+	c := w.client
+	log.Debugf("watch %s: connection lost: %v", w.mailbox, cause)
+	if err := c.reconnect(ctx); err != nil {
+		return err
+	}
+
+	selected, err := c.selectMailbox(w.mailbox, &imap.SelectOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	w.numMessages = selected.NumMessages
+	w.selectGen = c.selectGen
+
+	// 旧连接上未处理的推送数据已经失效
+	c.unilateral.drain()
+	w.emit(&MailboxEvent{
+		Type:    MailboxEventReconnected,
+		Mailbox: w.mailbox,
+		Err:     cause,
+	})
+	return nil
+}
+
+// idle 发送IDLE并等待服务器推送、超时、取消或其他调用需要使用连接
+func (w *mailboxWatcher) idle(ctx context.Context) error {
+	c := w.client
+	// 丢弃没有监听者时留下的通知，必须在检查waiting之前进行，否则可能丢掉新的通知
+	select {
+	case <-c.wake:
+	default:
+	}
+	if c.waiting.Load() > 0 {
+		return nil
+	}
+
+	idleCmd, err := c.client.Idle()
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(idleRestartInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-c.unilateral.notify:
+	case <-c.wake:
+	case <-timer.C:
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		return err
+	}
+	return idleCmd.Wait()
+}
+
+// handlePending 处理已缓存的推送数据并发送事件
+func (w *mailboxWatcher) handlePending(ctx context.Context) error {
+	var newFrom uint32 // 第一封新邮件的序号，0表示没有新邮件
+
+	for _, ev := range w.client.unilateral.drain() {
+		switch {
+		case ev.numMessages != nil:
+			n := *ev.numMessages
+			if n > w.numMessages && newFrom == 0 {
+				newFrom = w.numMessages + 1
+			}
+			w.numMessages = n
+
+		case ev.expunge != 0:
+			if w.numMessages > 0 {
+				w.numMessages--
+			}
+			if newFrom != 0 && ev.expunge < newFrom {
+				newFrom--
+			}
+			w.emit(&MailboxEvent{
+				Type:    MailboxEventExpunge,
+				Mailbox: w.mailbox,
+				SeqNum:  ev.expunge,
+			})
+
+		case ev.fetch != nil:
+			w.emit(&MailboxEvent{
+				Type:    MailboxEventFlagsChanged,
+				Mailbox: w.mailbox,
+				SeqNum:  ev.fetch.SeqNum,
+				UID:     ev.fetch.UID,
+				Flags:   ev.fetch.Flags,
+			})
+		}
+	}
+
+	if newFrom == 0 || newFrom > w.numMessages {
+		return nil
+	}
+
+	return w.fetchNew(ctx, newFrom)
+}
+
+// fetchNew 获取序号从from到最后一封邮件的摘要信息，并发送NewMessage事件
+func (w *mailboxWatcher) fetchNew(ctx context.Context, from uint32) error {
+	seqSet := imap.SeqSet{{Start: from, Stop: w.numMessages}}
+	msgs, err := w.client.client.Fetch(seqSet, headersFetchOptions()).Collect()
+	if err != nil {
+		return fmt.Errorf("fetch new messages: %w", err)
+	}
+
+	for _, buf := range msgs {
+		msg, err := w.client.parseMessageBuffer(buf)
+		if err != nil {
+			return err
+		}
+		msg.Attachments = w.client.lazyAttachments(w.mailbox, msg)
+		w.emit(&MailboxEvent{
+			Type:    MailboxEventNewMessage,
+			Mailbox: w.mailbox,
+			SeqNum:  buf.SeqNum,
+			UID:     buf.UID,
+			Flags:   buf.Flags,
+			Message: msg,
+		})
+	}
+
+	return nil
+}
+
+// emit 暂存事件，释放会话锁后由flush发送
+// 持有会话锁时向通道发送可能阻塞，而事件的接收方可能正在等待会话锁
+func (w *mailboxWatcher) emit(ev *MailboxEvent) {
+	w.pending = append(w.pending, ev)
+}
+
+// flush 发送暂存的事件，ctx被取消时放弃发送
+func (w *mailboxWatcher) flush(ctx context.Context) {
+	for _, ev := range w.pending {
+		select {
+		case w.events <- ev:
+		case <-ctx.Done():
+			w.pending = nil
+			return
+		}
+	}
+	w.pending = nil
+}
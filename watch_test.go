@@ -0,0 +1,87 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 多个goroutine同时读取不同邮箱并监听收件箱，应使用go test -race运行
+func TestConcurrentMailboxesWithWatch(t *testing.T) {
+	port := startTestServer(t, nil, "Sent")
+	c := dialTestServer(t, port)
+	for i := 0; i < 3; i++ {
+		for _, mailbox := range []string{"INBOX", "Sent"} {
+			subject := fmt.Sprintf("%s-%d", strings.ToLower(mailbox), i)
+			if _, err := c.Append(mailbox, strings.NewReader(testMessage(subject)), nil, time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Watch(ctx, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for _, mailbox := range []string{"INBOX", "Sent", "INBOX", "Sent"} {
+		wg.Add(1)
+		go func(mailbox string) {
+			defer wg.Done()
+			prefix := strings.ToLower(mailbox) + "-"
+			for i := 0; i < 20; i++ {
+				msgs, err := c.GetEmail(10, mailbox)
+				if err != nil {
+					errs <- fmt.Errorf("GetEmail(%q): %w", mailbox, err)
+					return
+				}
+				if len(msgs) != 3 {
+					errs <- fmt.Errorf("GetEmail(%q) returned %d messages, want 3", mailbox, len(msgs))
+					return
+				}
+				for _, msg := range msgs {
+					if !strings.HasPrefix(msg.Subject, prefix) {
+						errs <- fmt.Errorf("GetEmail(%q) returned message %q from another mailbox", mailbox, msg.Subject)
+						return
+					}
+				}
+			}
+		}(mailbox)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// 监听在并发读取结束后仍然有效
+	if _, err := c.Append("INBOX", strings.NewReader(testMessage("inbox-new")), nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("event channel closed")
+			}
+			switch ev.Type {
+			case MailboxEventError:
+				t.Fatal(ev.Err)
+			case MailboxEventNewMessage:
+				if ev.Message != nil && ev.Message.Subject == "inbox-new" {
+					return
+				}
+			}
+		case <-timeout:
+			t.Fatal("no event for the new message")
+		}
+	}
+}